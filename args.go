@@ -0,0 +1,161 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "fmt"
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/ugorji/go/codec"
+    "io"
+    "io/ioutil"
+    "strconv"
+    "strings"
+)
+
+// getCallArgs returns arguments of call given by options.args if there are
+// any, otherwise params in JSON or msgpack format are used.
+func getCallArgs(params string, options Options) (interface{}, error) {
+    switch {
+    case len(options.args) > 0:
+        return parseTypedArgs(options.args, options.mapParams, options.convertToInt64)
+    case options.msgpackParams:
+        return parseMsgpackParams([]byte(params))
+    }
+    return parseRPCParams(params, options.convertToInt64)
+}
+
+// parseMsgpackParams returns single msgpack object as arguments of call. They
+// are sent as they are, object that is not an array is passed as a single
+// parameter.
+func parseMsgpackParams(data []byte) (interface{}, error) {
+    decoder := convert.NewMsgpackDecoderBytes(data)
+
+    params, err := convert.DecodeRawMsgpack(decoder)
+    if err != nil {
+        return nil, decodeError(fmt.Errorf("Msgpack params: %s", err))
+    }
+    var rest interface{}
+    if err = decoder.Decode(&rest); err != io.EOF {
+        return nil, decodeError(fmt.Errorf("Msgpack params: single object expected"))
+    }
+
+    if !isMsgpackArray(params) {
+        params = append([]byte{0x91}, params...)
+    }
+    return codec.Raw(params), nil
+}
+
+// parseTypedArgs converts arguments given by --arg options to array of
+// params, or to single map of params when mapParams is set. In that case
+// every argument is given as <name>=<value>.
+func parseTypedArgs(args []string, mapParams, convertToInt64 bool) (interface{}, error) {
+    if !mapParams {
+        params := make([]interface{}, len(args))
+        for idx, arg := range args {
+            value, err := parseTypedArg(arg, convertToInt64)
+            if err != nil {
+                return nil, err
+            }
+            params[idx] = value
+        }
+        return params, nil
+    }
+
+    params := make(map[string]interface{}, len(args))
+    for _, arg := range args {
+        parts := strings.SplitN(arg, "=", 2)
+        if len(parts) != 2 || parts[0] == "" {
+            return nil, usageError(fmt.Errorf("Invalid argument %s, expected <name>=<value>", arg))
+        }
+        value, err := parseTypedArg(parts[1], convertToInt64)
+        if err != nil {
+            return nil, err
+        }
+        params[parts[0]] = value
+    }
+    return []interface{}{params}, nil
+}
+
+// parseTypedArg converts argument to value of type given by its prefix:
+//
+//     s:<text>         string
+//     i:<number>       integer
+//     f:<number>       float
+//     b:<bool>         boolean (true, false, 1, 0, ...)
+//     json:<json>      any JSON value
+//     @<file>          content of file as string
+//     bin:@<file>      content of file as binary
+//     bin:<text>       text as binary
+//
+// Argument without a known prefix is a string.
+func parseTypedArg(arg string, convertToInt64 bool) (value interface{}, err error) {
+    switch {
+    case strings.HasPrefix(arg, "s:"):
+        return arg[2:], nil
+    case strings.HasPrefix(arg, "i:"):
+        if value, err = strconv.ParseInt(arg[2:], 10, 64); err != nil {
+            return nil, usageError(fmt.Errorf("Invalid integer argument %s", arg))
+        }
+    case strings.HasPrefix(arg, "f:"):
+        if value, err = strconv.ParseFloat(arg[2:], 64); err != nil {
+            return nil, usageError(fmt.Errorf("Invalid float argument %s", arg))
+        }
+    case strings.HasPrefix(arg, "b:"):
+        if value, err = strconv.ParseBool(arg[2:]); err != nil {
+            return nil, usageError(fmt.Errorf("Invalid boolean argument %s", arg))
+        }
+    case strings.HasPrefix(arg, "json:"):
+        if value, err = decodeRPCParams(arg[5:], convertToInt64); err != nil {
+            return nil, usageError(fmt.Errorf("Invalid JSON argument %s: %s", arg, err))
+        }
+    case strings.HasPrefix(arg, "@"):
+        data, err := ioutil.ReadFile(arg[1:])
+        if err != nil {
+            return nil, err
+        }
+        value = string(data)
+    case strings.HasPrefix(arg, "bin:@"):
+        data, err := ioutil.ReadFile(arg[5:])
+        if err != nil {
+            return nil, err
+        }
+        value = msgpackBinary(data)
+    case strings.HasPrefix(arg, "bin:"):
+        value = msgpackBinary([]byte(arg[4:]))
+    default:
+        value = arg
+    }
+    return value, nil
+}
+
+// msgpackBinary returns data encoded as msgpack bin object. Handle encodes
+// byte slices as raw strings for compatibility with old decoders.
+func msgpackBinary(data []byte) codec.Raw {
+    var header []byte
+    switch n := len(data); {
+    case n <= 0xff:
+        header = []byte{0xc4, byte(n)}
+    case n <= 0xffff:
+        header = []byte{0xc5, byte(n >> 8), byte(n)}
+    default:
+        header = []byte{0xc6, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+    }
+    return codec.Raw(append(header, data...))
+}
+
+// isMsgpackArray returns true if data is encoded msgpack array.
+func isMsgpackArray(data []byte) bool {
+    return len(data) > 0 && (data[0]&0xf0 == 0x90 || data[0] == 0xdc || data[0] == 0xdd)
+}
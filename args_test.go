@@ -0,0 +1,82 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/ugorji/go/codec"
+    "reflect"
+    "testing"
+)
+
+func TestParseTypedArgs(t *testing.T) {
+    args := []string{"-5abc", "s:true", "i:-5", "i:010", "f:2", "b:1", "json:[1,{\"a\":null}]", "bin:ab"}
+    expected := []interface{}{
+        "-5abc", "true", int64(-5), int64(10), float64(2), true,
+        []interface{}{int64(1), map[string]interface{}{"a": nil}},
+        msgpackBinary([]byte("ab")),
+    }
+
+    params, err := parseTypedArgs(args, false, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(params, expected) {
+        t.Fatalf("Arguments were parsed to %#v", params)
+    }
+
+    params, err = parseTypedArgs([]string{"a=i:1", "b=x=y"}, true, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(params, []interface{}{map[string]interface{}{"a": int64(1), "b": "x=y"}}) {
+        t.Fatalf("Map arguments were parsed to %#v", params)
+    }
+
+    for _, arg := range []string{"i:1.5", "i:0x10", "f:x", "b:yes", "json:{"} {
+        if _, err = parseTypedArg(arg, true); exitCode(err) != exitUsage {
+            t.Fatalf("Invalid argument %s was accepted", arg)
+        }
+    }
+}
+
+func TestMsgpackBinaryHeader(t *testing.T) {
+    for _, size := range []int{0, 0xff, 0x100, 0x10000} {
+        raw := msgpackBinary(make([]byte, size))
+        var decoded []byte
+        if err := convert.DecodeMsgpack(raw, &decoded); err != nil || len(decoded) != size {
+            t.Fatalf("Binary of size %d was decoded to %d bytes: %v", size, len(decoded), err)
+        }
+    }
+}
+
+func TestParseMsgpackParams(t *testing.T) {
+    for _, c := range []struct{ data, expected []byte }{
+        {[]byte{0x92, 0x01, 0xa1, 0x61}, []byte{0x92, 0x01, 0xa1, 0x61}},
+        {[]byte{0xa1, 0x61}, []byte{0x91, 0xa1, 0x61}},
+    } {
+        params, err := parseMsgpackParams(c.data)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !reflect.DeepEqual(params, codec.Raw(c.expected)) {
+            t.Fatalf("Params %#v were parsed to %#v", c.data, params)
+        }
+    }
+
+    if _, err := parseMsgpackParams([]byte{0x01, 0x02}); exitCode(err) != exitDecode {
+        t.Fatal("Params of two objects were accepted")
+    }
+}
@@ -0,0 +1,210 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "io"
+    "net"
+    "os"
+    "time"
+)
+
+type batchCall struct {
+    Method string          `json:"method"`
+    Params json.RawMessage `json:"params"`
+    args   interface{}
+}
+
+type batchResult struct {
+    index   int
+    Msgid   uint32      `json:"msgid"`
+    Method  string      `json:"method"`
+    Result  interface{} `json:"result"`
+    Error   interface{} `json:"error"`
+    Latency float64     `json:"latency"`
+}
+
+// BatchRPC pipelines calls read from file over a single connection and
+// writes their results to STDOUT as JSON lines. Latency is in milliseconds.
+func BatchRPC(ctx context.Context, host, port, filename string, options Options) (err error) {
+    var (
+        calls []batchCall
+        conn  net.Conn
+    )
+
+    if calls, err = readBatchCalls(filename, options.convertToInt64); err != nil {
+        return err
+    }
+
+    if conn, err = dialRPC(ctx, host, port, options); err != nil {
+        return err
+    }
+    client := rpcclient.NewClient(conn, nil, nil)
+    defer client.Close()
+
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    results := make(chan batchResult)
+    slots := make(chan struct{}, options.inflight)
+
+    go func() {
+        for idx := range calls {
+            select {
+            case slots <- struct{}{}:
+            case <-ctx.Done():
+                return
+            }
+            start := time.Now()
+            callCtx, cancel := withTimeout(ctx, options.timeout)
+            stop := closeIfCancelled(callCtx, client)
+            c := client.Go(calls[idx].Method, calls[idx].args, nil)
+            stop()
+            go waitBatchCall(ctx, callCtx, cancel, c, idx, start, results, slots)
+        }
+    }()
+
+    var (
+        failed    int
+        next      int
+        completed = make(map[int]batchResult)
+    )
+
+    for n := 0; n < len(calls); n++ {
+        var res batchResult
+        select {
+        case res = <-results:
+        case <-ctx.Done():
+            return contextError(ctx)
+        }
+
+        if res.Error != nil {
+            failed++
+        }
+
+        if options.orderByCompletion {
+            if err = printBatchResult(res); err != nil {
+                return err
+            }
+            continue
+        }
+
+        completed[res.index] = res
+        for {
+            res, ok := completed[next]
+            if !ok {
+                break
+            }
+            delete(completed, next)
+            next++
+            if err = printBatchResult(res); err != nil {
+                return err
+            }
+        }
+    }
+
+    if failed > 0 {
+        return fmt.Errorf("%d of %d RPC calls failed", failed, len(calls))
+    }
+
+    return nil
+}
+
+// waitBatchCall sends result of call to results when it's done, or when
+// callCtx is done. Results are not sent after ctx of the batch is done.
+func waitBatchCall(ctx, callCtx context.Context, cancel context.CancelFunc, c *rpcclient.Call, idx int,
+    start time.Time, results chan<- batchResult, slots <-chan struct{}) {
+
+    res := batchResult{index: idx, Msgid: c.Msgid, Method: c.Method}
+    defer cancel()
+
+    select {
+    case <-c.Done:
+        if c.Err != nil {
+            res.Error = c.Err.Error()
+        } else {
+            res.Result = c.Reply
+            res.Error = c.RemoteErr
+        }
+    case <-callCtx.Done():
+        res.Error = contextError(callCtx).Error()
+    }
+
+    res.Latency = milliseconds(time.Since(start))
+
+    <-slots
+    select {
+    case results <- res:
+    case <-ctx.Done():
+    }
+}
+
+func printBatchResult(res batchResult) error {
+    data, err := encodeRPCReply(res, false)
+    if err == nil {
+        fmt.Print(data)
+    }
+    return err
+}
+
+// readBatchCalls reads one JSON object with method and params per line.
+func readBatchCalls(filename string, convertToInt64 bool) ([]batchCall, error) {
+    var reader io.Reader
+
+    if filename == "-" {
+        reader = os.Stdin
+    } else {
+        file, err := os.Open(filename)
+        if err != nil {
+            return nil, err
+        }
+        defer file.Close()
+        reader = file
+    }
+
+    var calls []batchCall
+
+    scanner := bufio.NewScanner(reader)
+    scanner.Buffer(nil, 64*1024*1024)
+    for lineno := 1; scanner.Scan(); lineno++ {
+        line := bytes.TrimSpace(scanner.Bytes())
+        if len(line) == 0 {
+            continue
+        }
+
+        var call batchCall
+        if err := json.Unmarshal(line, &call); err != nil {
+            return nil, decodeError(fmt.Errorf("Batch line %d: %s", lineno, err))
+        }
+        if call.Method == "" {
+            return nil, decodeError(fmt.Errorf("Batch line %d: missing method", lineno))
+        }
+
+        var err error
+        if call.args, err = decodeRPCParams(wrapJSONParams(call.Params), convertToInt64); err != nil {
+            return nil, decodeError(fmt.Errorf("Batch line %d: %s", lineno, err))
+        }
+
+        calls = append(calls, call)
+    }
+
+    return calls, scanner.Err()
+}
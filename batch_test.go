@@ -0,0 +1,75 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "io/ioutil"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestBatchRPCReportsTimedOutCalls(t *testing.T) {
+    host, port := listenEcho(t)
+
+    var lines []string
+    for n := 0; n < 20; n++ {
+        if n%2 == 0 {
+            lines = append(lines, `{"method": "echo", "params": [1]}`)
+        } else {
+            lines = append(lines, `{"method": "sleep"}`)
+        }
+    }
+    filename := filepath.Join(tempDir(t), "calls.jsonl")
+    if err := ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    options := Options{inflight: 4, timeout: 50 * time.Millisecond, convertToInt64: true}
+    done := make(chan error, 1)
+    output := captureStdout(t, func() {
+        go func() {
+            done <- BatchRPC(context.Background(), host, port, filename, options)
+        }()
+        select {
+        case err := <-done:
+            done <- err
+        case <-time.After(3 * time.Second):
+            t.Error("Batch didn't finish")
+            done <- nil
+        }
+    })
+
+    if err := <-done; err == nil || err.Error() != "10 of 20 RPC calls failed" {
+        t.Fatalf("Batch returned %v", err)
+    }
+
+    results := strings.Split(strings.TrimSpace(output), "\n")
+    if len(results) != 20 {
+        t.Fatalf("Batch wrote %d results:\n%s", len(results), output)
+    }
+    for n, line := range results {
+        var res map[string]interface{}
+        if err := json.Unmarshal([]byte(line), &res); err != nil {
+            t.Fatal(err)
+        }
+        if n%2 == 0 && res["error"] != nil || n%2 == 1 && res["error"] != errTimeout.Error() {
+            t.Fatalf("Call %d returned %s", n, line)
+        }
+    }
+}
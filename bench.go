@@ -0,0 +1,218 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "fmt"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "math"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// maxBenchRate is the highest rate of calls, so that interval between them
+// is at least a microsecond.
+const maxBenchRate = 1000000
+
+type benchLatency struct {
+    Min float64 `json:"min"`
+    P50 float64 `json:"p50"`
+    P90 float64 `json:"p90"`
+    P99 float64 `json:"p99"`
+    Max float64 `json:"max"`
+}
+
+type benchReport struct {
+    Requests   int            `json:"requests"`
+    Errors     int            `json:"errors"`
+    Duration   float64        `json:"duration"`
+    Throughput float64        `json:"throughput"`
+    Latency    benchLatency   `json:"latency"`
+    ErrorKinds map[string]int `json:"error_breakdown"`
+}
+
+type benchWorker struct {
+    client    rpcclient.Client
+    latencies []time.Duration
+    errors    map[string]int
+}
+
+// Bench calls method repeatedly from options.concurrency workers sharing
+// options.connections connections, until options.requests calls are made or
+// options.duration elapses, or ctx is done, and writes report to STDOUT.
+// Duration is in seconds, throughput in calls per second and latency in
+// milliseconds.
+func Bench(ctx context.Context, host, port, method, params string, options Options) (err error) {
+    var args interface{}
+
+    if args, err = getCallArgs(params, options); err != nil {
+        return err
+    }
+
+    clients := make([]rpcclient.Client, options.connections)
+    for idx := range clients {
+        conn, err := dialRPC(ctx, host, port, options)
+        if err != nil {
+            return err
+        }
+        clients[idx] = rpcclient.NewClient(conn, nil, nil)
+        defer clients[idx].Close()
+    }
+
+    var (
+        issued   int64
+        stop     = make(chan struct{})
+        stopOnce sync.Once
+        ticks    <-chan time.Time
+        workers  = make([]*benchWorker, options.concurrency)
+        wg       sync.WaitGroup
+    )
+
+    if options.rate > 0 {
+        ticker := time.NewTicker(time.Second / time.Duration(options.rate))
+        defer ticker.Stop()
+        ticks = ticker.C
+    }
+
+    go func() {
+        var deadline <-chan time.Time
+        if options.duration > 0 {
+            deadline = time.After(options.duration)
+        }
+        select {
+        case <-deadline:
+        case <-ctx.Done():
+        case <-stop:
+        }
+        stopOnce.Do(func() { close(stop) })
+    }()
+
+    start := time.Now()
+
+    for idx := range workers {
+        workers[idx] = &benchWorker{client: clients[idx%len(clients)], errors: make(map[string]int)}
+        wg.Add(1)
+        go func(w *benchWorker) {
+            defer wg.Done()
+            for {
+                if options.duration == 0 && atomic.AddInt64(&issued, 1) > int64(options.requests) {
+                    return
+                }
+                if ticks != nil {
+                    select {
+                    case <-ticks:
+                    case <-stop:
+                        return
+                    }
+                }
+                select {
+                case <-stop:
+                    return
+                case <-w.client.Done():
+                    return
+                default:
+                }
+                w.call(ctx, method, args, options.timeout)
+            }
+        }(workers[idx])
+    }
+
+    wg.Wait()
+    elapsed := time.Since(start)
+    stopOnce.Do(func() { close(stop) })
+
+    report := newBenchReport(workers, elapsed)
+    if data, err := encodeRPCReply(report, options.indent); err == nil {
+        fmt.Println(data)
+    } else {
+        return err
+    }
+
+    return nil
+}
+
+func (w *benchWorker) call(ctx context.Context, method string, args interface{}, timeout time.Duration) {
+    ctx, cancel := withTimeout(ctx, timeout)
+    defer cancel()
+
+    start := time.Now()
+    stop := closeIfCancelled(ctx, w.client)
+    call := w.client.Go(method, args, nil)
+    stop()
+
+    select {
+    case <-call.Done:
+        if call.Err != nil {
+            w.errors[call.Err.Error()]++
+        } else if call.RemoteErr != nil {
+            w.errors[(&rpcclient.RemoteError{Value: call.RemoteErr}).Error()]++
+        } else {
+            w.latencies = append(w.latencies, time.Since(start))
+        }
+    case <-ctx.Done():
+        // call cut off by interruption is not counted
+        if ctx.Err() == context.DeadlineExceeded {
+            w.errors[errTimeout.Error()]++
+        }
+    }
+}
+
+func newBenchReport(workers []*benchWorker, elapsed time.Duration) benchReport {
+    var latencies []time.Duration
+
+    report := benchReport{ErrorKinds: make(map[string]int)}
+    for _, w := range workers {
+        latencies = append(latencies, w.latencies...)
+        for kind, count := range w.errors {
+            report.ErrorKinds[kind] += count
+            report.Errors += count
+        }
+    }
+
+    report.Requests = len(latencies) + report.Errors
+    report.Duration = elapsed.Seconds()
+    if elapsed > 0 {
+        report.Throughput = float64(report.Requests) / elapsed.Seconds()
+    }
+
+    if len(latencies) > 0 {
+        sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+        report.Latency = benchLatency{
+            Min: milliseconds(latencies[0]),
+            P50: milliseconds(percentile(latencies, 0.50)),
+            P90: milliseconds(percentile(latencies, 0.90)),
+            P99: milliseconds(percentile(latencies, 0.99)),
+            Max: milliseconds(latencies[len(latencies)-1]),
+        }
+    }
+
+    return report
+}
+
+// percentile returns p-th percentile of sorted latencies (nearest rank).
+func percentile(sorted []time.Duration, p float64) time.Duration {
+    rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+    if rank < 0 {
+        rank = 0
+    }
+    return sorted[rank]
+}
+
+func milliseconds(d time.Duration) float64 {
+    return float64(d) / float64(time.Millisecond)
+}
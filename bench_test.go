@@ -0,0 +1,80 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestPercentile(t *testing.T) {
+    sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+    cases := []struct {
+        latencies []time.Duration
+        p         float64
+        expected  time.Duration
+    }{
+        {sorted, 0.50, 5},
+        {sorted, 0.90, 9},
+        {sorted, 0.99, 10},
+        {sorted, 1, 10},
+        {sorted, 0, 1},
+        {sorted[:1], 0.50, 1},
+        {sorted[:3], 0.50, 2},
+    }
+    for _, c := range cases {
+        if value := percentile(c.latencies, c.p); value != c.expected {
+            t.Fatalf("Percentile %v of %v is %v", c.p, c.latencies, value)
+        }
+    }
+}
+
+func TestNewBenchReport(t *testing.T) {
+    ms := time.Millisecond
+
+    cases := []struct {
+        workers  []*benchWorker
+        elapsed  time.Duration
+        expected benchReport
+    }{
+        {
+            []*benchWorker{
+                {latencies: []time.Duration{3 * ms, 1 * ms}, errors: map[string]int{"timeout": 1}},
+                {latencies: []time.Duration{2 * ms, 4 * ms}, errors: map[string]int{"timeout": 1, "remote": 2}},
+            },
+            2 * time.Second,
+            benchReport{
+                Requests:   8,
+                Errors:     4,
+                Duration:   2,
+                Throughput: 4,
+                Latency:    benchLatency{Min: 1, P50: 2, P90: 4, P99: 4, Max: 4},
+                ErrorKinds: map[string]int{"timeout": 2, "remote": 2},
+            },
+        },
+        {
+            []*benchWorker{{errors: map[string]int{"connection": 1}}},
+            0,
+            benchReport{Requests: 1, Errors: 1, ErrorKinds: map[string]int{"connection": 1}},
+        },
+    }
+    for _, c := range cases {
+        if report := newBenchReport(c.workers, c.elapsed); !reflect.DeepEqual(report, c.expected) {
+            t.Fatalf("Unexpected report %#v", report)
+        }
+    }
+}
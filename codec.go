@@ -15,21 +15,46 @@
 package main
 
 import (
-    "io"
+    "fmt"
+    "github.com/jakm/msgpack-cli/convert"
     "os"
+    "strings"
 )
 
-type Encoder interface {
-    Encode(v interface{}) error
-}
-
-type Decoder interface {
-    Decode(v interface{}) error
-}
+// ConvertFormats converts data read from input file (- for STDIN) in format
+// from to format to and writes them to output file, or to STDOUT if it's
+// empty. Input and output bytes are in options.inEncoding and
+// options.outEncoding. Compressed input is decompressed, output is compressed
+// by options.compression if it's set.
+func ConvertFormats(inFilename, outFilename, from, to string, options Options) error {
+    for _, name := range []string{from, to} {
+        if _, err := convert.LookupFormat(name); err != nil {
+            return usageError(err)
+        }
+    }
+    for _, name := range []string{options.inEncoding, options.outEncoding} {
+        if err := convert.CheckEncoding(name); err != nil {
+            return usageError(err)
+        }
+    }
+    if options.compression != "" {
+        if err := convert.CheckCompression(options.compression); err != nil {
+            return usageError(err)
+        }
+    }
 
-type ConversionFunc func(r io.Reader, w io.Writer, options Options) error
+    convertOptions := convert.Options{
+        ConvertToInt64: options.convertToInt64,
+        Indent:         options.indent,
+    }
+    if options.schemaFile != "" {
+        schema, err := readSchema(options.schemaFile)
+        if err != nil {
+            return err
+        }
+        convertOptions.Schema = schema
+    }
 
-func ConvertFormats(inFilename, outFilename string, conversionFunc ConversionFunc, options Options) error {
     var inFile *os.File
     var err error
 
@@ -51,55 +76,64 @@ func ConvertFormats(inFilename, outFilename string, conversionFunc ConversionFun
         defer outFile.Close()
     }
 
-    if err = conversionFunc(inFile, outFile, options); err != nil {
+    decoded, _ := convert.NewEncodingReader(inFile, options.inEncoding)
+    reader, err := convert.NewDecompressingReader(decoded)
+    if err != nil {
+        return decodeError(err)
+    }
+    defer reader.Close()
+    writer, _ := convert.NewEncodingWriter(outFile, options.outEncoding)
+    compressor, err := convert.NewCompressingWriter(writer, options.compression)
+    if err != nil {
         return err
     }
 
-    return nil
-}
-
-func ConvertJSON2Msgpack(reader io.Reader, writer io.Writer, options Options) (err error) {
-    var object interface{}
-
-    decoder := NewJSONDecoder(reader, options.convertToInt64)
-    encoder := NewMsgpackEncoder(writer)
-
-    for {
-        if err = decoder.Decode(&object); err != nil {
-            if err == io.EOF {
-                break
-            } else {
-                return err
-            }
-        }
-
-        if err = encoder.Encode(object); err != nil {
-            return err
-        }
+    if err = convert.ConvertFormat(reader, compressor, from, to, convertOptions); err != nil {
+        return err
     }
 
-    return nil
+    if err = compressor.Close(); err != nil {
+        return err
+    }
+    return writer.Close()
 }
 
-func ConvertMsgpack2JSON(reader io.Reader, writer io.Writer, options Options) (err error) {
-    var object interface{}
+func readSchema(filename string) (*convert.Schema, error) {
+    file, err := os.Open(filename)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
 
-    decoder := NewMsgpackDecoder(reader)
-    encoder := NewJSONEncoder(writer, options.indent)
+    schema, err := convert.ReadSchema(file)
+    if err != nil {
+        return nil, usageError(err)
+    }
+    return schema, nil
+}
 
-    for {
-        if err = decoder.Decode(&object); err != nil {
-            if err == io.EOF {
-                break
-            } else {
-                return err
-            }
-        }
+// formatCapabilities returns capabilities of format separated by commas.
+func formatCapabilities(format convert.Format) string {
+    var capabilities []string
+    if format.BinarySafe {
+        capabilities = append(capabilities, "binary-safe")
+    }
+    if format.OrderedMaps {
+        capabilities = append(capabilities, "ordered-maps")
+    }
+    if format.TypedInts {
+        capabilities = append(capabilities, "typed-ints")
+    }
+    return strings.Join(capabilities, ", ")
+}
 
-        if err = encoder.Encode(object); err != nil {
-            return err
+// PrintFormats writes registered formats with their capabilities to STDOUT.
+func PrintFormats() {
+    for _, format := range convert.Formats() {
+        if capabilities := formatCapabilities(format); capabilities != "" {
+            fmt.Printf("%-10s %s\n", format.Name, capabilities)
+        } else {
+            fmt.Println(format.Name)
         }
     }
-
-    return nil
 }
@@ -0,0 +1,124 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "github.com/golang/snappy"
+    "github.com/klauspost/compress/zstd"
+    "github.com/pierrec/lz4/v4"
+    "io"
+    "io/ioutil"
+    "strings"
+)
+
+// Compressions are formats that can compress output of conversion. Input
+// compressed by any of them is detected by its magic bytes.
+var Compressions = []string{"gzip", "zstd", "lz4", "snappy"}
+
+// compressionMagics are the first bytes of compressed streams, snappy stream
+// starts with its stream identifier chunk.
+var compressionMagics = []struct {
+    name  string
+    magic []byte
+}{
+    {"gzip", []byte{0x1f, 0x8b, 0x08}},
+    {"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+    {"lz4", []byte{0x04, 0x22, 0x4d, 0x18}},
+    {"snappy", []byte("\xff\x06\x00\x00sNaPpY")},
+}
+
+// NewDecompressingReader returns reader decompressing data read from r if
+// they start with magic bytes of one of Compressions, otherwise data are
+// read as they are. Close releases the decompressor, it doesn't close r.
+func NewDecompressingReader(r io.Reader) (io.ReadCloser, error) {
+    buffered := bufio.NewReader(r)
+    head, err := buffered.Peek(10)
+    if err != nil && err != io.EOF {
+        return nil, err
+    }
+
+    for _, compression := range compressionMagics {
+        if !bytes.HasPrefix(head, compression.magic) {
+            continue
+        }
+        switch compression.name {
+        case "gzip":
+            reader, err := gzip.NewReader(buffered)
+            if err != nil {
+                return nil, err
+            }
+            return reader, nil
+        case "zstd":
+            decoder, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+            if err != nil {
+                return nil, err
+            }
+            return decoder.IOReadCloser(), nil
+        case "lz4":
+            return ioutil.NopCloser(lz4.NewReader(buffered)), nil
+        case "snappy":
+            return ioutil.NopCloser(snappy.NewReader(buffered)), nil
+        }
+    }
+    return ioutil.NopCloser(buffered), nil
+}
+
+// Decompress returns data decompressed if they are compressed by one of
+// Compressions, otherwise data are returned as they are.
+func Decompress(data []byte) ([]byte, error) {
+    reader, err := NewDecompressingReader(bytes.NewReader(data))
+    if err != nil {
+        return nil, err
+    }
+    defer reader.Close()
+    return ioutil.ReadAll(reader)
+}
+
+// NewCompressingWriter returns writer compressing bytes written to w by
+// compression, empty compression keeps them as they are. Close writes the
+// rest of compressed stream, it doesn't close w.
+func NewCompressingWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+    switch compression {
+    case "":
+        return nopWriteCloser{w}, nil
+    case "gzip":
+        return gzip.NewWriter(w), nil
+    case "zstd":
+        return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+    case "lz4":
+        return lz4.NewWriter(w), nil
+    case "snappy":
+        return snappy.NewBufferedWriter(w), nil
+    }
+    return nil, unknownCompression(compression)
+}
+
+// CheckCompression returns error if compression isn't one of Compressions.
+func CheckCompression(compression string) error {
+    for _, name := range Compressions {
+        if name == compression {
+            return nil
+        }
+    }
+    return unknownCompression(compression)
+}
+
+func unknownCompression(compression string) error {
+    return fmt.Errorf("Unknown compression %s, expected one of: %s", compression, strings.Join(Compressions, ", "))
+}
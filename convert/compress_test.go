@@ -0,0 +1,82 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "bytes"
+    "encoding/hex"
+    "math/rand"
+    "testing"
+)
+
+func TestCompressionsRoundTrip(t *testing.T) {
+    // repeated and random data over several lz4 blocks
+    data := bytes.Repeat([]byte("\x82\xa2id\x01\xa4name\xa5first"), 10000)
+    random := make([]byte, 100000)
+    rand.New(rand.NewSource(1)).Read(random)
+    data = append(data, random...)
+
+    for _, compression := range Compressions {
+        var compressed bytes.Buffer
+        writer, err := NewCompressingWriter(&compressed, compression)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if _, err = writer.Write(data); err != nil {
+            t.Fatal(err)
+        }
+        if err = writer.Close(); err != nil {
+            t.Fatal(err)
+        }
+
+        decompressed, err := Decompress(compressed.Bytes())
+        if err != nil {
+            t.Fatalf("Decompression of %s failed: %s", compression, err)
+        }
+        if !bytes.Equal(decompressed, data) {
+            t.Fatalf("Round trip of %s returned %d different bytes", compression, len(decompressed))
+        }
+    }
+}
+
+func TestDecompressKeepsUncompressedData(t *testing.T) {
+    for _, data := range [][]byte{{}, {0x1f}, {0x1f, 0x8b, 0x01}, []byte("\x82\xa1a\x01\xa1b\x02")} {
+        decompressed, err := Decompress(data)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !bytes.Equal(decompressed, data) {
+            t.Fatalf("Uncompressed data % x were changed to % x", data, decompressed)
+        }
+    }
+}
+
+func TestDecompressReadsReferenceLZ4Frame(t *testing.T) {
+    // written by lz4 tool with block and content checksums
+    frame, _ := hex.DecodeString("04224d187440bd150000003f616263030014d02d6d73677061636b2d636c690affc2c06400000000d0a30883")
+
+    data, err := Decompress(frame)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if expected := "abcabcabcabcabcabcabcabcabcabcabcabcabcabc-msgpack-cli\n"; string(data) != expected {
+        t.Fatalf("Frame was decompressed to %q", data)
+    }
+
+    frame[len(frame)-1]++
+    if _, err = Decompress(frame); err == nil {
+        t.Fatal("Frame with invalid content checksum was decompressed")
+    }
+}
@@ -0,0 +1,133 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package convert converts streams of objects between JSON, msgpack and other
+// registered formats.
+package convert
+
+import (
+    "bytes"
+    "io"
+)
+
+type Encoder interface {
+    Encode(v interface{}) error
+}
+
+type Decoder interface {
+    Decode(v interface{}) error
+}
+
+// Flusher is implemented by encoders that write output only when all objects
+// were encoded.
+type Flusher interface {
+    Flush() error
+}
+
+// Options of conversion.
+type Options struct {
+    // ConvertToInt64 decodes JSON numbers to int64 or float64 by their
+    // meaning, otherwise all numbers are float64.
+    ConvertToInt64 bool
+    // Indent pretty-prints output JSON.
+    Indent bool
+    // Schema of positional arrays, they are unpacked to maps when msgpack is
+    // decoded and packed back when it's encoded.
+    Schema *Schema
+}
+
+// DecodeError is returned when input data can't be decoded.
+type DecodeError struct {
+    Err error
+}
+
+func (e *DecodeError) Error() string {
+    return e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+    return e.Err
+}
+
+// Convert decodes objects by decoder and encodes them by encoder until EOF.
+// Encoder is flushed at the end if it's Flusher.
+func Convert(decoder Decoder, encoder Encoder) (err error) {
+    var object interface{}
+
+    for {
+        // don't decode into value of previous object
+        object = nil
+        if err = decoder.Decode(&object); err != nil {
+            if err == io.EOF {
+                break
+            } else {
+                return &DecodeError{err}
+            }
+        }
+
+        if err = encoder.Encode(object); err != nil {
+            return err
+        }
+    }
+
+    if flusher, ok := encoder.(Flusher); ok {
+        return flusher.Flush()
+    }
+    return nil
+}
+
+// JSONToMsgpack converts stream of JSON objects read from r to msgpack.
+func JSONToMsgpack(r io.Reader, w io.Writer, options Options) error {
+    return ConvertFormat(r, w, "json", "msgpack", options)
+}
+
+// MsgpackToJSON converts stream of msgpack objects read from r to JSON.
+func MsgpackToJSON(r io.Reader, w io.Writer, options Options) error {
+    return ConvertFormat(r, w, "msgpack", "json", options)
+}
+
+// EncodeJSON returns object encoded to JSON. Output ends with newline.
+func EncodeJSON(object interface{}, indent bool) ([]byte, error) {
+    var buffer bytes.Buffer
+    if err := NewJSONEncoder(&buffer, indent).Encode(object); err != nil {
+        return nil, err
+    }
+    return buffer.Bytes(), nil
+}
+
+// DecodeJSON returns the first JSON object in data.
+func DecodeJSON(data []byte, convertToInt64 bool) (interface{}, error) {
+    var object interface{}
+    if err := NewJSONDecoder(bytes.NewReader(data), convertToInt64).Decode(&object); err != nil {
+        return nil, &DecodeError{err}
+    }
+    return object, nil
+}
+
+// EncodeMsgpack returns object encoded to msgpack.
+func EncodeMsgpack(object interface{}) ([]byte, error) {
+    var data []byte
+    if err := NewMsgpackEncoderBytes(&data).Encode(object); err != nil {
+        return nil, err
+    }
+    return data, nil
+}
+
+// DecodeMsgpack decodes the first msgpack object in data into v.
+func DecodeMsgpack(data []byte, v interface{}) error {
+    if err := NewMsgpackDecoderBytes(data).Decode(v); err != nil {
+        return &DecodeError{err}
+    }
+    return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestConvertDecodesObjectsSeparately(t *testing.T) {
+    // {"a": 1} followed by {"b": 2}
+    input := []byte("\x81\xa1a\x01\x81\xa1b\x02")
+
+    var output bytes.Buffer
+    if err := Convert(NewMsgpackDecoder(bytes.NewReader(input)), NewJSONEncoder(&output, false)); err != nil {
+        t.Fatal(err)
+    }
+    if expected := "{\"a\":1}\n{\"b\":2}\n"; output.String() != expected {
+        t.Fatalf("Objects were converted to %q", output.String())
+    }
+
+    output.Reset()
+    if err := Convert(NewJSONDecoder(bytes.NewReader([]byte("{\"a\": 1} {\"b\": 2}")), true), NewMsgpackEncoder(&output)); err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(output.Bytes(), input) {
+        t.Fatalf("Objects were converted to % x", output.Bytes())
+    }
+}
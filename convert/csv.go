@@ -0,0 +1,309 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "encoding/base64"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+var csvNumberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+func init() {
+    for name, comma := range map[string]rune{"csv": ',', "tsv": '\t'} {
+        comma := comma
+        RegisterFormat(Format{
+            Name: name,
+            NewEncoder: func(w io.Writer, options Options) Encoder {
+                return NewCSVEncoder(w, comma)
+            },
+            NewDecoder: func(r io.Reader, options Options) Decoder {
+                return NewCSVDecoder(r, comma, options.ConvertToInt64)
+            },
+            EncodesBinary: true,
+        })
+    }
+}
+
+// csvEncoder collects rows until Flush, because header is known only after
+// all of them were seen.
+type csvEncoder struct {
+    w       *csv.Writer
+    rows    []map[string]string
+    columns map[string]bool
+}
+
+func (e *csvEncoder) Encode(v interface{}) error {
+    rows, ok := v.([]interface{})
+    if !ok {
+        if tables, ok := v.([]map[string]interface{}); ok {
+            rows = make([]interface{}, len(tables))
+            for idx, table := range tables {
+                rows[idx] = table
+            }
+        } else {
+            rows = []interface{}{v}
+        }
+    }
+
+    for _, row := range rows {
+        fields, ok := row.(map[string]interface{})
+        if !ok {
+            return fmt.Errorf("CSV row must be a map, not %T", row)
+        }
+        flat := make(map[string]string)
+        flattenCSVValue("", fields, flat)
+        for column := range flat {
+            e.columns[column] = true
+        }
+        e.rows = append(e.rows, flat)
+    }
+    return nil
+}
+
+func (e *csvEncoder) Flush() error {
+    if len(e.rows) == 0 {
+        return nil
+    }
+
+    header := make([]string, 0, len(e.columns))
+    for column := range e.columns {
+        header = append(header, column)
+    }
+    sort.Slice(header, func(i, j int) bool { return lessCSVColumn(header[i], header[j]) })
+
+    if err := e.w.Write(header); err != nil {
+        return err
+    }
+    record := make([]string, len(header))
+    for _, row := range e.rows {
+        for idx, column := range header {
+            record[idx] = row[column]
+        }
+        if err := e.w.Write(record); err != nil {
+            return err
+        }
+    }
+
+    e.w.Flush()
+    return e.w.Error()
+}
+
+// flattenCSVValue stores value to row, nested values under dotted paths.
+func flattenCSVValue(path string, value interface{}, row map[string]string) {
+    join := func(key string) string {
+        if path == "" {
+            return key
+        }
+        return path + "." + key
+    }
+
+    switch value := value.(type) {
+    case map[string]interface{}:
+        if len(value) == 0 && path != "" {
+            row[path] = "{}"
+        }
+        for key, elem := range value {
+            flattenCSVValue(join(key), elem, row)
+        }
+    case []interface{}:
+        if len(value) == 0 {
+            row[path] = "[]"
+        }
+        for idx, elem := range value {
+            flattenCSVValue(join(strconv.Itoa(idx)), elem, row)
+        }
+    case []map[string]interface{}:
+        elems := make([]interface{}, len(value))
+        for idx, elem := range value {
+            elems[idx] = elem
+        }
+        flattenCSVValue(path, elems, row)
+    default:
+        row[path] = formatCSVValue(value)
+    }
+}
+
+func formatCSVValue(value interface{}) string {
+    switch value := value.(type) {
+    case nil:
+        return ""
+    case string:
+        return value
+    case []byte:
+        return base64.StdEncoding.EncodeToString(value)
+    case time.Time:
+        return value.Format(time.RFC3339Nano)
+    }
+    if data, err := json.Marshal(value); err == nil {
+        return string(data)
+    }
+    return fmt.Sprint(value)
+}
+
+// lessCSVColumn compares dotted paths by their parts, numeric parts as numbers,
+// so that elements of arrays are in order.
+func lessCSVColumn(a, b string) bool {
+    partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+    for idx := 0; idx < len(partsA) && idx < len(partsB); idx++ {
+        if partsA[idx] == partsB[idx] {
+            continue
+        }
+        numA, errA := strconv.Atoi(partsA[idx])
+        numB, errB := strconv.Atoi(partsB[idx])
+        if errA == nil && errB == nil {
+            return numA < numB
+        }
+        return partsA[idx] < partsB[idx]
+    }
+    return len(partsA) < len(partsB)
+}
+
+type csvDecoder struct {
+    r              *csv.Reader
+    header         []string
+    convertToInt64 bool
+}
+
+func (d *csvDecoder) Decode(v interface{}) error {
+    object, ok := v.(*interface{})
+    if !ok {
+        return fmt.Errorf("CSV can't decode to %T", v)
+    }
+
+    if d.header == nil {
+        header, err := d.r.Read()
+        if err != nil {
+            return err
+        }
+        d.header = header
+    }
+
+    record, err := d.r.Read()
+    if err != nil {
+        return err
+    }
+
+    fields := make(map[string]interface{})
+    for idx, column := range d.header {
+        if record[idx] == "" {
+            continue
+        }
+        if err = unflattenCSVValue(fields, column, d.parseValue(record[idx])); err != nil {
+            return err
+        }
+    }
+
+    *object = arraysFromCSVMaps(fields)
+    return nil
+}
+
+// parseValue infers type of value, numbers are converted as JSON numbers.
+func (d *csvDecoder) parseValue(field string) interface{} {
+    switch {
+    case field == "true":
+        return true
+    case field == "false":
+        return false
+    case csvNumberPattern.MatchString(field):
+        if !d.convertToInt64 {
+            if value, err := strconv.ParseFloat(field, 64); err == nil {
+                return value
+            }
+            return field
+        }
+        var value interface{} = json.Number(field)
+        if err := ConvertNumberTypes(&value); err == nil {
+            return value
+        }
+    }
+    return field
+}
+
+// unflattenCSVValue stores value to object under dotted path.
+func unflattenCSVValue(object map[string]interface{}, path string, value interface{}) error {
+    parts := strings.Split(path, ".")
+    for _, part := range parts[:len(parts)-1] {
+        next, ok := object[part]
+        if !ok {
+            next = make(map[string]interface{})
+            object[part] = next
+        }
+        if object, ok = next.(map[string]interface{}); !ok {
+            return fmt.Errorf("Column %s conflicts with column %s", path, part)
+        }
+    }
+
+    last := parts[len(parts)-1]
+    if _, ok := object[last]; ok {
+        return fmt.Errorf("Column %s conflicts with other columns", path)
+    }
+    object[last] = value
+    return nil
+}
+
+// arraysFromCSVMaps replaces maps with keys 0..n-1 by arrays, recursively.
+func arraysFromCSVMaps(value interface{}) interface{} {
+    object, ok := value.(map[string]interface{})
+    if !ok {
+        return value
+    }
+
+    for key, elem := range object {
+        object[key] = arraysFromCSVMaps(elem)
+    }
+
+    array := make([]interface{}, len(object))
+    for key, elem := range object {
+        idx, err := strconv.Atoi(key)
+        if err != nil || idx < 0 || idx >= len(array) || strconv.Itoa(idx) != key {
+            return object
+        }
+        array[idx] = elem
+    }
+    if len(array) == 0 {
+        return object
+    }
+    return array
+}
+
+// NewCSVEncoder returns encoder writing maps, or arrays of maps, to w as rows
+// of CSV table separated by comma. Header is union of keys of all rows, nested
+// values are flattened to columns with dotted paths and binary strings are
+// written in base64. Table is written by Flush.
+func NewCSVEncoder(w io.Writer, comma rune) Encoder {
+    writer := csv.NewWriter(w)
+    writer.Comma = comma
+    return &csvEncoder{w: writer, columns: make(map[string]bool)}
+}
+
+// NewCSVDecoder returns decoder reading rows of CSV table separated by comma
+// from r as maps. The first row is header, columns with dotted paths are
+// decoded to nested maps and arrays and empty fields are left out. Numbers
+// and booleans are recognized, numbers are decoded like JSON numbers.
+func NewCSVDecoder(r io.Reader, comma rune, convertToInt64 bool) Decoder {
+    reader := csv.NewReader(r)
+    reader.Comma = comma
+    reader.LazyQuotes = comma == '\t'
+    return &csvDecoder{r: reader, convertToInt64: convertToInt64}
+}
@@ -0,0 +1,101 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "bytes"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestCSVEncoderFlattensRows(t *testing.T) {
+    var output bytes.Buffer
+    encoder := NewCSVEncoder(&output, ',')
+
+    objects := []interface{}{
+        map[string]interface{}{"id": int64(1), "data": []byte("ab"), "pos": map[string]interface{}{"x": 1.5}},
+        []interface{}{
+            map[string]interface{}{"id": int64(2), "tags": []interface{}{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}},
+        },
+    }
+    for _, object := range objects {
+        if err := encoder.Encode(object); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := encoder.(Flusher).Flush(); err != nil {
+        t.Fatal(err)
+    }
+
+    expected := "data,id,pos.x,tags.0,tags.1,tags.2,tags.3,tags.4,tags.5,tags.6,tags.7,tags.8,tags.9,tags.10\n" +
+        "YWI=,1,1.5,,,,,,,,,,,\n" +
+        ",2,,a,b,c,d,e,f,g,h,i,j,k\n"
+    if output.String() != expected {
+        t.Fatalf("Encoder wrote %q", output.String())
+    }
+
+    if err := NewCSVEncoder(&output, ',').Encode("text"); err == nil {
+        t.Fatal("String was encoded as CSV row")
+    }
+}
+
+func TestCSVDecoderInfersTypes(t *testing.T) {
+    input := "id,ratio,ok,zip,pos.x,tags.0,tags.1,note\n7,0.5,true,007,-1e3,a,b,\n"
+    decoder := NewCSVDecoder(strings.NewReader(input), ',', true)
+
+    var object interface{}
+    if err := decoder.Decode(&object); err != nil {
+        t.Fatal(err)
+    }
+
+    expected := map[string]interface{}{
+        "id":    int64(7),
+        "ratio": 0.5,
+        "ok":    true,
+        "zip":   "007",
+        "pos":   map[string]interface{}{"x": -1e3},
+        "tags":  []interface{}{"a", "b"},
+    }
+    if !reflect.DeepEqual(object, expected) {
+        t.Fatalf("Row was decoded as %#v", object)
+    }
+}
+
+func TestCSVDecoderRejectsOtherTargets(t *testing.T) {
+    decoder := NewCSVDecoder(strings.NewReader("a\n1\n"), ',', true)
+
+    var object map[string]interface{}
+    if err := decoder.Decode(&object); err == nil {
+        t.Fatal("Row was decoded to map")
+    }
+    if err := decoder.Decode(nil); err == nil {
+        t.Fatal("Row was decoded to nil")
+    }
+}
+
+func TestConvertMsgpackBinToCSV(t *testing.T) {
+    // {"a": 1, "b": bin 8 with bytes 00 ff 10}
+    input := []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0xc4, 0x03, 0x00, 0xff, 0x10}
+
+    var output bytes.Buffer
+    if err := ConvertFormat(bytes.NewReader(input), &output, "msgpack", "csv", Options{}); err != nil {
+        t.Fatal(err)
+    }
+
+    if expected := "a,b\n1,AP8Q\n"; output.String() != expected {
+        t.Fatalf("Converted to %q, expected %q", output.String(), expected)
+    }
+}
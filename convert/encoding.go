@@ -0,0 +1,243 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "strconv"
+    "strings"
+)
+
+// Encodings are text encodings of bytes that can wrap input or output of
+// conversion, raw keeps bytes as they are.
+var Encodings = []string{"raw", "hex", "base64", "base64url", "c-array"}
+
+// NewEncodingReader returns reader decoding bytes read from r from encoding.
+// Whitespace in hex and base64 input is ignored, padding of base64 is
+// optional. C array is read as initializer list of integer literals, e.g.
+// {0x82, 0xa1, 97}, possibly with declaration and comments around.
+func NewEncodingReader(r io.Reader, encoding string) (io.Reader, error) {
+    switch encoding {
+    case "raw":
+        return r, nil
+    case "hex":
+        return hex.NewDecoder(&filteringReader{r, isEncodingSpace}), nil
+    case "base64":
+        return base64.NewDecoder(base64.RawStdEncoding, &filteringReader{r, isBase64Ignored}), nil
+    case "base64url":
+        return base64.NewDecoder(base64.RawURLEncoding, &filteringReader{r, isBase64Ignored}), nil
+    case "c-array":
+        return &cArrayReader{r: r}, nil
+    }
+    return nil, unknownEncoding(encoding)
+}
+
+// NewEncodingWriter returns writer encoding bytes written to w to encoding.
+// Close writes the rest of output ended by newline, it doesn't close w.
+func NewEncodingWriter(w io.Writer, encoding string) (io.WriteCloser, error) {
+    switch encoding {
+    case "raw":
+        return nopWriteCloser{w}, nil
+    case "hex":
+        return &lineWriter{hex.NewEncoder(w), nil, w}, nil
+    case "base64":
+        encoder := base64.NewEncoder(base64.StdEncoding, w)
+        return &lineWriter{encoder, encoder, w}, nil
+    case "base64url":
+        encoder := base64.NewEncoder(base64.URLEncoding, w)
+        return &lineWriter{encoder, encoder, w}, nil
+    case "c-array":
+        return &cArrayWriter{w: bufio.NewWriter(w)}, nil
+    }
+    return nil, unknownEncoding(encoding)
+}
+
+// CheckEncoding returns error if encoding isn't one of Encodings.
+func CheckEncoding(encoding string) error {
+    for _, name := range Encodings {
+        if name == encoding {
+            return nil
+        }
+    }
+    return unknownEncoding(encoding)
+}
+
+func unknownEncoding(encoding string) error {
+    return fmt.Errorf("Unknown encoding %s, expected one of: %s", encoding, strings.Join(Encodings, ", "))
+}
+
+func isEncodingSpace(b byte) bool {
+    return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+func isBase64Ignored(b byte) bool {
+    return isEncodingSpace(b) || b == '='
+}
+
+// filteringReader drops bytes for which ignore returns true.
+type filteringReader struct {
+    r      io.Reader
+    ignore func(byte) bool
+}
+
+func (f *filteringReader) Read(p []byte) (int, error) {
+    for {
+        n, err := f.r.Read(p)
+        kept := 0
+        for _, b := range p[:n] {
+            if !f.ignore(b) {
+                p[kept] = b
+                kept++
+            }
+        }
+        if kept > 0 || err != nil {
+            return kept, err
+        }
+    }
+}
+
+// cArrayReader parses the whole C array at the first read.
+type cArrayReader struct {
+    r    io.Reader
+    data *bytes.Reader
+}
+
+func (c *cArrayReader) Read(p []byte) (int, error) {
+    if c.data == nil {
+        source, err := ioutil.ReadAll(c.r)
+        if err != nil {
+            return 0, err
+        }
+        data, err := parseCArray(string(source))
+        if err != nil {
+            return 0, err
+        }
+        c.data = bytes.NewReader(data)
+    }
+    return c.data.Read(p)
+}
+
+// parseCArray returns bytes given by integer literals of C array initializer.
+func parseCArray(source string) ([]byte, error) {
+    source = stripCComments(source)
+    if start := strings.IndexByte(source, '{'); start >= 0 {
+        end := strings.IndexByte(source[start:], '}')
+        if end < 0 {
+            return nil, fmt.Errorf("C array: missing }")
+        }
+        source = source[start+1 : start+end]
+    }
+
+    var data []byte
+    for _, literal := range strings.FieldsFunc(source, func(r rune) bool {
+        return r == ',' || r < 128 && isEncodingSpace(byte(r))
+    }) {
+        // integer suffixes, e.g. 0x82u
+        literal = strings.TrimRight(literal, "uUlL")
+        value, err := strconv.ParseUint(literal, 0, 8)
+        if err != nil {
+            return nil, fmt.Errorf("C array: invalid byte %s", literal)
+        }
+        data = append(data, byte(value))
+    }
+    return data, nil
+}
+
+func stripCComments(source string) string {
+    var result strings.Builder
+    for len(source) > 0 {
+        switch {
+        case strings.HasPrefix(source, "//"):
+            if end := strings.IndexByte(source, '\n'); end >= 0 {
+                source = source[end:]
+            } else {
+                source = ""
+            }
+        case strings.HasPrefix(source, "/*"):
+            if end := strings.Index(source[2:], "*/"); end >= 0 {
+                source = source[end+4:]
+            } else {
+                source = ""
+            }
+        default:
+            result.WriteByte(source[0])
+            source = source[1:]
+        }
+    }
+    return result.String()
+}
+
+type nopWriteCloser struct {
+    io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+    return nil
+}
+
+// lineWriter ends output of encoder by newline when closed.
+type lineWriter struct {
+    io.Writer
+    encoder io.Closer
+    w       io.Writer
+}
+
+func (l *lineWriter) Close() error {
+    if l.encoder != nil {
+        if err := l.encoder.Close(); err != nil {
+            return err
+        }
+    }
+    _, err := io.WriteString(l.w, "\n")
+    return err
+}
+
+// cArrayWriter writes bytes as C array initializer, 12 bytes per line.
+type cArrayWriter struct {
+    w *bufio.Writer
+    n int
+}
+
+func (c *cArrayWriter) Write(p []byte) (int, error) {
+    for idx, b := range p {
+        switch {
+        case c.n == 0:
+            c.w.WriteString("{\n    ")
+        case c.n%12 == 0:
+            c.w.WriteString(",\n    ")
+        default:
+            c.w.WriteString(", ")
+        }
+        if _, err := fmt.Fprintf(c.w, "0x%02x", b); err != nil {
+            return idx, err
+        }
+        c.n++
+    }
+    return len(p), nil
+}
+
+func (c *cArrayWriter) Close() error {
+    if c.n == 0 {
+        c.w.WriteString("{")
+    }
+    c.w.WriteString("\n}\n")
+    return c.w.Flush()
+}
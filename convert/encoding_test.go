@@ -0,0 +1,80 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "bytes"
+    "io/ioutil"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestEncodingsRoundTrip(t *testing.T) {
+    data := []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0xc4, 0x02, 0xfb, 0xff, 0x00, 0x3e, 0x3f}
+
+    for _, encoding := range Encodings {
+        var encoded bytes.Buffer
+        writer, err := NewEncodingWriter(&encoded, encoding)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if _, err = writer.Write(data); err != nil {
+            t.Fatal(err)
+        }
+        if err = writer.Close(); err != nil {
+            t.Fatal(err)
+        }
+
+        reader, err := NewEncodingReader(&encoded, encoding)
+        if err != nil {
+            t.Fatal(err)
+        }
+        decoded, err := ioutil.ReadAll(reader)
+        if err != nil {
+            t.Fatalf("Decoding of %s failed: %s", encoding, err)
+        }
+        if !reflect.DeepEqual(decoded, data) {
+            t.Fatalf("Round trip of %s returned % x", encoding, decoded)
+        }
+    }
+}
+
+func TestEncodingReaderAcceptsLooseInput(t *testing.T) {
+    cases := []struct {
+        encoding string
+        input    string
+    }{
+        {"hex", "81 a1 61\n01\n"},
+        {"base64", "gaFh\nAQ\n"},
+        {"base64url", "gaFhAQ=="},
+        {"c-array", "const uint8_t msg[] = { // map\n 0x81, 0xa1, /* key */ 97u, 1 };\n"},
+    }
+
+    for _, c := range cases {
+        reader, _ := NewEncodingReader(strings.NewReader(c.input), c.encoding)
+        decoded, err := ioutil.ReadAll(reader)
+        if err != nil {
+            t.Fatalf("Decoding of %s failed: %s", c.encoding, err)
+        }
+        if !reflect.DeepEqual(decoded, []byte{0x81, 0xa1, 'a', 0x01}) {
+            t.Fatalf("Input %q in %s was decoded as % x", c.input, c.encoding, decoded)
+        }
+    }
+
+    if err := CheckEncoding("base32"); err == nil {
+        t.Fatal("Unknown encoding was accepted")
+    }
+}
@@ -0,0 +1,142 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// Format is a named data format that objects can be converted from and to.
+type Format struct {
+    Name       string
+    NewEncoder func(w io.Writer, options Options) Encoder
+    NewDecoder func(r io.Reader, options Options) Decoder
+    // BinarySafe is set if binary strings are kept as they are.
+    BinarySafe bool
+    // OrderedMaps is set if order of map keys is kept.
+    OrderedMaps bool
+    // TypedInts is set if integers and floats are told apart.
+    TypedInts bool
+    // EncodesBinary is set if encoder writes []byte values in its own way,
+    // msgpack bin is decoded to []byte instead of string for it.
+    EncodesBinary bool
+}
+
+var (
+    formats      = make(map[string]Format)
+    formatsMutex sync.RWMutex
+)
+
+func init() {
+    RegisterFormat(Format{
+        Name: "json",
+        NewEncoder: func(w io.Writer, options Options) Encoder {
+            return NewJSONEncoder(w, options.Indent)
+        },
+        NewDecoder: func(r io.Reader, options Options) Decoder {
+            return NewJSONDecoder(r, options.ConvertToInt64)
+        },
+    })
+    RegisterFormat(Format{
+        Name: "msgpack",
+        NewEncoder: func(w io.Writer, options Options) Encoder {
+            return NewMsgpackEncoder(w)
+        },
+        NewDecoder: func(r io.Reader, options Options) Decoder {
+            return NewMsgpackDecoder(r)
+        },
+        BinarySafe: true,
+        TypedInts:  true,
+    })
+}
+
+// RegisterFormat makes format available by its name. It panics if format
+// with the same name is already registered.
+func RegisterFormat(format Format) {
+    formatsMutex.Lock()
+    defer formatsMutex.Unlock()
+
+    if _, ok := formats[format.Name]; ok {
+        panic("convert: format " + format.Name + " is already registered")
+    }
+    formats[format.Name] = format
+}
+
+// LookupFormat returns registered format of given name.
+func LookupFormat(name string) (Format, error) {
+    formatsMutex.RLock()
+    defer formatsMutex.RUnlock()
+
+    if format, ok := formats[name]; ok {
+        return format, nil
+    }
+    return Format{}, fmt.Errorf("Unknown format %s, expected one of: %s", name, strings.Join(formatNames(), ", "))
+}
+
+// Formats returns registered formats sorted by name.
+func Formats() []Format {
+    formatsMutex.RLock()
+    defer formatsMutex.RUnlock()
+
+    list := make([]Format, 0, len(formats))
+    for _, name := range formatNames() {
+        list = append(list, formats[name])
+    }
+    return list
+}
+
+// formatNames returns sorted names of formats, mutex must be held by caller.
+func formatNames() []string {
+    names := make([]string, 0, len(formats))
+    for name := range formats {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// ConvertFormat converts stream of objects read from r in format from to
+// format to. Positional arrays of msgpack are converted by options.Schema.
+func ConvertFormat(r io.Reader, w io.Writer, from, to string, options Options) error {
+    input, err := LookupFormat(from)
+    if err != nil {
+        return err
+    }
+    output, err := LookupFormat(to)
+    if err != nil {
+        return err
+    }
+
+    var decoder Decoder
+    if from == "msgpack" && output.EncodesBinary {
+        decoder = NewMsgpackBinDecoder(r)
+    } else {
+        decoder = input.NewDecoder(r, options)
+    }
+    encoder := output.NewEncoder(w, options)
+    if options.Schema != nil {
+        if from == "msgpack" {
+            decoder = NewSchemaDecoder(decoder, options.Schema)
+        }
+        if to == "msgpack" {
+            encoder = NewSchemaEncoder(encoder, options.Schema)
+        }
+    }
+    return Convert(decoder, encoder)
+}
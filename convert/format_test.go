@@ -0,0 +1,75 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "bytes"
+    "io"
+    "strings"
+    "testing"
+)
+
+func TestConvertFormatRoundTrip(t *testing.T) {
+    input := "{\"a\":[1,2.5,\"x\"]}\n[true,null]\n"
+
+    var packed, unpacked bytes.Buffer
+    options := Options{ConvertToInt64: true}
+
+    if err := ConvertFormat(strings.NewReader(input), &packed, "json", "msgpack", options); err != nil {
+        t.Fatal(err)
+    }
+    if err := ConvertFormat(&packed, &unpacked, "msgpack", "json", options); err != nil {
+        t.Fatal(err)
+    }
+    if unpacked.String() != input {
+        t.Fatalf("Round trip returned %q", unpacked.String())
+    }
+}
+
+func TestRegisterFormat(t *testing.T) {
+    RegisterFormat(Format{
+        Name: "test-lines",
+        NewEncoder: func(w io.Writer, options Options) Encoder {
+            return NewJSONEncoder(w, false)
+        },
+        NewDecoder: func(r io.Reader, options Options) Decoder {
+            return NewJSONDecoder(r, options.ConvertToInt64)
+        },
+    })
+    t.Cleanup(func() {
+        formatsMutex.Lock()
+        delete(formats, "test-lines")
+        formatsMutex.Unlock()
+    })
+
+    var output bytes.Buffer
+    if err := ConvertFormat(strings.NewReader("1 2"), &output, "test-lines", "json", Options{}); err != nil {
+        t.Fatal(err)
+    }
+    if output.String() != "1\n2\n" {
+        t.Fatalf("Conversion returned %q", output.String())
+    }
+
+    if _, err := LookupFormat("unknown"); err == nil {
+        t.Fatal("Unknown format was found")
+    }
+
+    defer func() {
+        if recover() == nil {
+            t.Fatal("Format was registered twice")
+        }
+    }()
+    RegisterFormat(Format{Name: "json"})
+}
@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package convert
 
 import (
     "encoding/json"
@@ -44,12 +44,14 @@ type convertingJSONDecoder struct {
 
 func (d *convertingJSONDecoder) Decode(v interface{}) error {
     if err := d.d.Decode(&v); err == nil {
-        return convertNumberTypes(&v)
+        return ConvertNumberTypes(&v)
     } else {
         return err
     }
 }
 
+// NewJSONEncoder returns encoder writing JSON objects to w, indented if indent
+// is set.
 func NewJSONEncoder(w io.Writer, indent bool) Encoder {
     if indent {
         return &indentedJSONEncoder{w}
@@ -58,6 +60,9 @@ func NewJSONEncoder(w io.Writer, indent bool) Encoder {
     }
 }
 
+// NewJSONDecoder returns decoder reading JSON objects from r. If
+// convertToInt64 is set, numbers are decoded to int64 or float64 by their
+// meaning, otherwise all numbers are float64.
 func NewJSONDecoder(r io.Reader, convertToInt64 bool) Decoder {
     if convertToInt64 {
         d := json.NewDecoder(r)
@@ -68,11 +73,13 @@ func NewJSONDecoder(r io.Reader, convertToInt64 bool) Decoder {
     }
 }
 
-func convertNumberTypes(object *interface{}) (err error) {
+// ConvertNumberTypes replaces json.Number values in object, recursively, by
+// int64 or float64 values according to their meaning.
+func ConvertNumberTypes(object *interface{}) (err error) {
     switch value := (*object).(type) {
     case *interface{}:
         // fmt.Printf("Type %s, value %v\n", reflect.TypeOf(value), value)
-        err = convertNumberTypes(value)
+        err = ConvertNumberTypes(value)
     case json.Number:
         // fmt.Printf("Type %s, value %v\n", reflect.TypeOf(value), value)
         if strings.ContainsAny(value.String(), ".eE") {
@@ -83,14 +90,14 @@ func convertNumberTypes(object *interface{}) (err error) {
     case []interface{}:
         // fmt.Printf("Type %s, value %v\n", reflect.TypeOf(value), value)
         for idx := range value {
-            if err = convertNumberTypes(&value[idx]); err != nil {
+            if err = ConvertNumberTypes(&value[idx]); err != nil {
                 break
             }
         }
     case map[string]interface{}:
         // fmt.Printf("Type %s, value %v\n", reflect.TypeOf(value), value)
         for k, v := range value {
-            if err = convertNumberTypes(&v); err != nil {
+            if err = ConvertNumberTypes(&v); err != nil {
                 break
             } else {
                 value[k] = v
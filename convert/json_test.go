@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package convert
 
 import (
     "encoding/json"
@@ -35,7 +35,7 @@ func testConversionOfScalarValue(t *testing.T) {
     for _, num := range []string{"0.0", ".0", "-4.", "3.14159", "-4.8e-8", "34e15"} {
         object = json.Number(num)
 
-        err = convertNumberTypes(&object)
+        err = ConvertNumberTypes(&object)
 
         if err != nil {
             t.Fatalf("Conversion of value \"%s\" failed: %s", num, err)
@@ -50,7 +50,7 @@ func testConversionOfScalarValue(t *testing.T) {
     for _, num := range []string{"0", "256", "-3", "123456789", "1234567890000"} {
         object = json.Number(num)
 
-        err = convertNumberTypes(&object)
+        err = ConvertNumberTypes(&object)
 
         if err != nil {
             t.Fatalf("Conversion of value \"%s\" failed: %s", num, err)
@@ -83,7 +83,7 @@ func testRecursiveConversionOfSlice(t *testing.T) {
         }
     }
 
-    if err := convertNumberTypes(&object); err != nil {
+    if err := ConvertNumberTypes(&object); err != nil {
         t.Fatalf("Conversion of slice %v failed: %s", object, err)
     } else {
         switch object := object.(type) {
@@ -128,7 +128,7 @@ func testRecursiveConversionOfMap(t *testing.T) {
         }
     }
 
-    if err := convertNumberTypes(&object); err != nil {
+    if err := ConvertNumberTypes(&object); err != nil {
         t.Fatalf("Conversion of map %v failed: %s", object, err)
     } else {
         switch object := object.(type) {
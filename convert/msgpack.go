@@ -0,0 +1,155 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "encoding/binary"
+    "github.com/ugorji/go/codec"
+    "io"
+    "reflect"
+    "time"
+)
+
+// MsgpackHandle returns handle used by msgpack encoders and decoders. Strings
+// are decoded from raw bytes, maps to map[string]interface{} and codec.Raw
+// values are encoded as they are.
+func MsgpackHandle() *codec.MsgpackHandle {
+    h := &codec.MsgpackHandle{}
+    h.RawToString = true
+    h.Raw = true
+    h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+    return h
+}
+
+// msgpackEncoder encodes time.Time values as msgpack timestamps. Handle
+// would write them as raw strings, because it doesn't use extensions for
+// compatibility with old decoders.
+type msgpackEncoder struct {
+    e *codec.Encoder
+}
+
+func (e *msgpackEncoder) Encode(v interface{}) error {
+    v, _ = replaceTimestamps(v)
+    return e.e.Encode(v)
+}
+
+func NewMsgpackEncoder(w io.Writer) Encoder {
+    h := MsgpackHandle()
+    return &msgpackEncoder{codec.NewEncoder(w, h)}
+}
+
+func NewMsgpackEncoderBytes(b *[]byte) Encoder {
+    h := MsgpackHandle()
+    return &msgpackEncoder{codec.NewEncoderBytes(b, h)}
+}
+
+func NewMsgpackDecoder(r io.Reader) Decoder {
+    h := MsgpackHandle()
+    return codec.NewDecoder(r, h)
+}
+
+func NewMsgpackDecoderBytes(b []byte) Decoder {
+    h := MsgpackHandle()
+    return codec.NewDecoderBytes(b, h)
+}
+
+// NewMsgpackBinDecoder returns decoder that tells bin values apart from
+// strings, bin is decoded to []byte and str to string.
+func NewMsgpackBinDecoder(r io.Reader) Decoder {
+    h := MsgpackHandle()
+    h.RawToString = false
+    // str is decoded to string as in new spec
+    h.WriteExt = true
+    return codec.NewDecoder(r, h)
+}
+
+// DecodeRawMsgpack reads exact bytes of the next msgpack object.
+func DecodeRawMsgpack(decoder Decoder) ([]byte, error) {
+    var raw codec.Raw
+    if err := decoder.Decode(&raw); err != nil {
+        return nil, err
+    }
+    return raw, nil
+}
+
+// replaceTimestamps returns object with time.Time values replaced by encoded
+// msgpack timestamps. Containers are copied only if they hold a timestamp,
+// the second value reports whether object was changed.
+func replaceTimestamps(object interface{}) (interface{}, bool) {
+    switch value := object.(type) {
+    case time.Time:
+        return codec.Raw(msgpackTimestamp(value)), true
+    case map[string]interface{}:
+        var replaced map[string]interface{}
+        for key, elem := range value {
+            if elem, ok := replaceTimestamps(elem); ok {
+                if replaced == nil {
+                    replaced = make(map[string]interface{}, len(value))
+                    for k, v := range value {
+                        replaced[k] = v
+                    }
+                }
+                replaced[key] = elem
+            }
+        }
+        if replaced != nil {
+            return replaced, true
+        }
+    case []interface{}:
+        var replaced []interface{}
+        for idx, elem := range value {
+            if elem, ok := replaceTimestamps(elem); ok {
+                if replaced == nil {
+                    replaced = append([]interface{}(nil), value...)
+                }
+                replaced[idx] = elem
+            }
+        }
+        if replaced != nil {
+            return replaced, true
+        }
+    case []map[string]interface{}:
+        // arrays of TOML tables
+        elems := make([]interface{}, len(value))
+        for idx, elem := range value {
+            elems[idx] = elem
+        }
+        return replaceTimestamps(elems)
+    }
+    return object, false
+}
+
+// msgpackTimestamp returns t encoded as msgpack timestamp extension in the
+// smallest of its 32, 64 and 96 bit formats.
+func msgpackTimestamp(t time.Time) []byte {
+    sec, nsec := t.Unix(), uint64(t.Nanosecond())
+
+    if sec >= 0 && sec>>34 == 0 {
+        if data := nsec<<34 | uint64(sec); data>>32 == 0 {
+            data32 := make([]byte, 4)
+            binary.BigEndian.PutUint32(data32, uint32(data))
+            return append([]byte{0xd6, 0xff}, data32...)
+        } else {
+            data64 := make([]byte, 8)
+            binary.BigEndian.PutUint64(data64, data)
+            return append([]byte{0xd7, 0xff}, data64...)
+        }
+    }
+
+    data96 := make([]byte, 12)
+    binary.BigEndian.PutUint32(data96, uint32(nsec))
+    binary.BigEndian.PutUint64(data96[4:], uint64(sec))
+    return append([]byte{0xc7, 12, 0xff}, data96...)
+}
@@ -0,0 +1,51 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestMsgpackTimestamp(t *testing.T) {
+    cases := []struct {
+        time    time.Time
+        encoded []byte
+    }{
+        {time.Unix(1, 0), []byte{0xd6, 0xff, 0, 0, 0, 1}},
+        {time.Unix(1, 1), []byte{0xd7, 0xff, 0, 0, 0, 0x04, 0, 0, 0, 1}},
+        {time.Unix(-1, 0), []byte{0xc7, 12, 0xff, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+    }
+
+    for _, c := range cases {
+        encoded, err := EncodeMsgpack(map[string]interface{}{"t": c.time})
+        if err != nil {
+            t.Fatal(err)
+        }
+        expected := append([]byte{0x81, 0xa1, 't'}, c.encoded...)
+        if !reflect.DeepEqual(encoded, expected) {
+            t.Fatalf("Time %s was encoded as % x", c.time, encoded)
+        }
+
+        var decoded map[string]interface{}
+        if err = DecodeMsgpack(encoded, &decoded); err != nil {
+            t.Fatal(err)
+        }
+        if !c.time.Equal(decoded["t"].(time.Time)) {
+            t.Fatalf("Time %s was decoded as %s", c.time, decoded["t"])
+        }
+    }
+}
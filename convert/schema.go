@@ -0,0 +1,188 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "strconv"
+)
+
+// Schema describes positional arrays, so that they can be converted to maps
+// with named fields and back. Value with Fields is an array of the fields in
+// order, value with Items is an array of elements described by Items. Schema
+// is read from JSON, where field can be given just by its name and fields of
+// value by array, e.g. {"fields": ["id", {"name": "pos", "fields": ["x",
+// "y"]}]} or ["id", "name"].
+type Schema struct {
+    Name   string    `json:"name,omitempty"`
+    Fields []*Schema `json:"fields,omitempty"`
+    Items  *Schema   `json:"items,omitempty"`
+}
+
+func (s *Schema) UnmarshalJSON(data []byte) error {
+    if err := json.Unmarshal(data, &s.Name); err == nil {
+        return nil
+    }
+    if err := json.Unmarshal(data, &s.Fields); err == nil {
+        return nil
+    }
+    // alias doesn't have this method
+    type schema Schema
+    return json.Unmarshal(data, (*schema)(s))
+}
+
+// ReadSchema reads schema in JSON from r.
+func ReadSchema(r io.Reader) (*Schema, error) {
+    var schema Schema
+    if err := json.NewDecoder(r).Decode(&schema); err != nil {
+        return nil, fmt.Errorf("Schema: %s", err)
+    }
+    return &schema, nil
+}
+
+// Unpack returns value with positional arrays replaced by maps of fields.
+// Missing trailing elements are left out, elements beyond fields of schema
+// are named by their position.
+func (s *Schema) Unpack(value interface{}) interface{} {
+    array, ok := value.([]interface{})
+    if s == nil || !ok {
+        return value
+    }
+
+    if s.Items != nil {
+        named := make([]interface{}, len(array))
+        for idx, elem := range array {
+            named[idx] = s.Items.Unpack(elem)
+        }
+        return named
+    }
+
+    if s.Fields == nil {
+        return value
+    }
+    named := make(map[string]interface{}, len(array))
+    for idx, elem := range array {
+        if idx < len(s.Fields) {
+            named[s.Fields[idx].Name] = s.Fields[idx].Unpack(elem)
+        } else {
+            named[strconv.Itoa(idx)] = elem
+        }
+    }
+    return named
+}
+
+// Pack returns value with maps of fields replaced by positional arrays.
+// Missing fields are nil, fields named by position are put to it.
+func (s *Schema) Pack(value interface{}) (interface{}, error) {
+    if s == nil {
+        return value, nil
+    }
+
+    if s.Items != nil {
+        array, ok := value.([]interface{})
+        if !ok {
+            return value, nil
+        }
+        packed := make([]interface{}, len(array))
+        for idx, elem := range array {
+            var err error
+            if packed[idx], err = s.Items.Pack(elem); err != nil {
+                return nil, err
+            }
+        }
+        return packed, nil
+    }
+
+    named, ok := value.(map[string]interface{})
+    if s.Fields == nil || !ok {
+        return value, nil
+    }
+
+    positions := make(map[string]int, len(s.Fields))
+    for idx, field := range s.Fields {
+        positions[field.Name] = idx
+    }
+
+    var packed []interface{}
+    for key, elem := range named {
+        var err error
+        idx, ok := positions[key]
+        if ok {
+            if elem, err = s.Fields[idx].Pack(elem); err != nil {
+                return nil, err
+            }
+        } else if idx, err = strconv.Atoi(key); err != nil || idx < len(s.Fields) || idx >= len(s.Fields)+len(named) {
+            return nil, fmt.Errorf("Field %s isn't described by schema", key)
+        }
+        for len(packed) <= idx {
+            packed = append(packed, nil)
+        }
+        packed[idx] = elem
+    }
+    if packed == nil {
+        packed = []interface{}{}
+    }
+    return packed, nil
+}
+
+type namingDecoder struct {
+    d      Decoder
+    schema *Schema
+}
+
+func (d *namingDecoder) Decode(v interface{}) error {
+    object, ok := v.(*interface{})
+    if !ok {
+        return fmt.Errorf("Schema can't decode to %T", v)
+    }
+    if err := d.d.Decode(object); err != nil {
+        return err
+    }
+    *object = d.schema.Unpack(*object)
+    return nil
+}
+
+type packingEncoder struct {
+    e      Encoder
+    schema *Schema
+}
+
+func (e *packingEncoder) Encode(v interface{}) error {
+    packed, err := e.schema.Pack(v)
+    if err != nil {
+        return err
+    }
+    return e.e.Encode(packed)
+}
+
+func (e *packingEncoder) Flush() error {
+    if flusher, ok := e.e.(Flusher); ok {
+        return flusher.Flush()
+    }
+    return nil
+}
+
+// NewSchemaDecoder returns decoder naming fields of objects decoded by d.
+func NewSchemaDecoder(d Decoder, schema *Schema) Decoder {
+    return &namingDecoder{d, schema}
+}
+
+// NewSchemaEncoder returns encoder packing objects to positional arrays before
+// they are encoded by e.
+func NewSchemaEncoder(e Encoder, schema *Schema) Encoder {
+    return &packingEncoder{e, schema}
+}
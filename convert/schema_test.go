@@ -0,0 +1,59 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestSchemaUnpackAndPack(t *testing.T) {
+    schema, err := ReadSchema(strings.NewReader(`{"fields": ["id", {"name": "pos", "fields": ["x", "y"]},
+        {"name": "tags", "items": ["k", "v"]}, "note"]}`))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    positional := []interface{}{
+        int64(1),
+        []interface{}{int64(3), int64(4)},
+        []interface{}{[]interface{}{"a", int64(1)}},
+        nil,
+        "extra",
+    }
+    named := map[string]interface{}{
+        "id":   int64(1),
+        "pos":  map[string]interface{}{"x": int64(3), "y": int64(4)},
+        "tags": []interface{}{map[string]interface{}{"k": "a", "v": int64(1)}},
+        "note": nil,
+        "4":    "extra",
+    }
+
+    if unpacked := schema.Unpack(positional); !reflect.DeepEqual(unpacked, named) {
+        t.Fatalf("Array was unpacked to %#v", unpacked)
+    }
+    packed, err := schema.Pack(named)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(packed, positional) {
+        t.Fatalf("Map was packed to %#v", packed)
+    }
+
+    if _, err = schema.Pack(map[string]interface{}{"unknown": 1}); err == nil {
+        t.Fatal("Field missing in schema was packed")
+    }
+}
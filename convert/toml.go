@@ -0,0 +1,78 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "errors"
+    "fmt"
+    "github.com/BurntSushi/toml"
+    "io"
+)
+
+func init() {
+    RegisterFormat(Format{
+        Name: "toml",
+        NewEncoder: func(w io.Writer, options Options) Encoder {
+            return NewTOMLEncoder(w)
+        },
+        NewDecoder: func(r io.Reader, options Options) Decoder {
+            return NewTOMLDecoder(r)
+        },
+        TypedInts: true,
+    })
+}
+
+type tomlEncoder struct {
+    w       io.Writer
+    encoded bool
+}
+
+func (e *tomlEncoder) Encode(v interface{}) error {
+    if e.encoded {
+        return errors.New("TOML document is a single table, more objects can't be encoded")
+    }
+    if _, ok := v.(map[string]interface{}); !ok {
+        return fmt.Errorf("TOML document must be a table, not %T", v)
+    }
+    e.encoded = true
+    return toml.NewEncoder(e.w).Encode(v)
+}
+
+type tomlDecoder struct {
+    r       io.Reader
+    decoded bool
+}
+
+func (d *tomlDecoder) Decode(v interface{}) error {
+    if d.decoded {
+        return io.EOF
+    }
+    d.decoded = true
+    _, err := toml.NewDecoder(d.r).Decode(v)
+    return err
+}
+
+// NewTOMLEncoder returns encoder writing single table to w as TOML document.
+// Datetimes are written as TOML datetimes.
+func NewTOMLEncoder(w io.Writer) Encoder {
+    return &tomlEncoder{w: w}
+}
+
+// NewTOMLDecoder returns decoder reading whole TOML document from r as single
+// table. Integers are decoded to int64, floats to float64 and datetimes to
+// time.Time.
+func NewTOMLDecoder(r io.Reader) Decoder {
+    return &tomlDecoder{r: r}
+}
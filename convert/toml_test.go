@@ -0,0 +1,65 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestTOMLToMsgpackKeepsTypes(t *testing.T) {
+    input := "count = 3\nratio = 3.0\nstarted = 1979-05-27T07:32:00Z\n\n[[rules]]\n  name = \"x\"\n"
+
+    var packed bytes.Buffer
+    if err := ConvertFormat(strings.NewReader(input), &packed, "toml", "msgpack", Options{}); err != nil {
+        t.Fatal(err)
+    }
+
+    var object map[string]interface{}
+    if err := DecodeMsgpack(packed.Bytes(), &object); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := object["count"].(int64); !ok {
+        t.Fatalf("Integer was decoded as %T", object["count"])
+    }
+    if _, ok := object["ratio"].(float64); !ok {
+        t.Fatalf("Float was decoded as %T", object["ratio"])
+    }
+    started, ok := object["started"].(time.Time)
+    if !ok || !started.Equal(time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)) {
+        t.Fatalf("Datetime was decoded as %#v", object["started"])
+    }
+
+    var output bytes.Buffer
+    if err := ConvertFormat(&packed, &output, "msgpack", "toml", Options{}); err != nil {
+        t.Fatal(err)
+    }
+    if output.String() != input {
+        t.Fatalf("Round trip returned %q", output.String())
+    }
+}
+
+func TestTOMLEncoderRequiresSingleTable(t *testing.T) {
+    var output bytes.Buffer
+
+    if err := ConvertFormat(strings.NewReader("[1]"), &output, "json", "toml", Options{}); err == nil {
+        t.Fatal("Array was encoded as TOML document")
+    }
+    if err := ConvertFormat(strings.NewReader("{} {}"), &output, "json", "toml", Options{}); err == nil {
+        t.Fatal("Two tables were encoded as TOML document")
+    }
+}
@@ -0,0 +1,278 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "io/ioutil"
+    "os"
+    "sort"
+    "strings"
+    "time"
+)
+
+var errUnsupportedDescription = errors.New("Unsupported description of RPC methods")
+
+// methodDescription describes RPC method. Params are nil if server doesn't
+// describe them.
+type methodDescription struct {
+    Name    string        `json:"name"`
+    Params  []methodParam `json:"params"`
+    Returns string        `json:"returns,omitempty"`
+}
+
+type methodParam struct {
+    Name string `json:"name,omitempty"`
+    Type string `json:"type,omitempty"`
+}
+
+// Describe calls discovery method options.discovery and writes methods of
+// server to STDOUT, one per line with names and types of params, as JSON if
+// options.jsonOutput is set, or only their names if options.methodNames is
+// set. If options.cacheFile is set, description is read from it if it's not
+// older than options.cacheTTL and it was written for the same host, port and
+// discovery method, otherwise it's written there.
+func Describe(ctx context.Context, host, port string, options Options) (err error) {
+    var methods []methodDescription
+
+    if options.cacheFile != "" {
+        methods = readCachedMethods(options.cacheFile, options.cacheTTL, host, port, options.discovery)
+    }
+
+    if methods == nil {
+        if methods, err = discoverMethods(ctx, host, port, options); err != nil {
+            return err
+        }
+        if options.cacheFile != "" {
+            if err = writeCachedMethods(options.cacheFile, methods, host, port, options.discovery); err != nil {
+                return err
+            }
+        }
+    }
+
+    if options.jsonOutput {
+        data, err := encodeRPCReply(methods, options.indent)
+        if err != nil {
+            return err
+        }
+        fmt.Print(data)
+        return nil
+    }
+
+    for _, method := range methods {
+        if options.methodNames {
+            fmt.Println(method.Name)
+        } else {
+            fmt.Println(method.String())
+        }
+    }
+    return nil
+}
+
+func discoverMethods(ctx context.Context, host, port string, options Options) ([]methodDescription, error) {
+    conn, err := dialRPC(ctx, host, port, options)
+    if err != nil {
+        return nil, err
+    }
+    client := rpcclient.NewClient(conn, nil, nil)
+    defer client.Close()
+
+    ctx, cancel := withTimeout(ctx, options.timeout)
+    defer cancel()
+
+    stop := closeIfCancelled(ctx, client)
+    call := client.Go(options.discovery, []interface{}{}, nil)
+    stop()
+
+    reply, err := waitRPCReply(ctx, call, options)
+    if err != nil {
+        return nil, err
+    }
+
+    methods, err := parseMethodDescriptions(reply)
+    if err != nil {
+        return nil, decodeError(err)
+    }
+    return methods, nil
+}
+
+// String returns method in form name(type param, ...) -> type.
+func (m methodDescription) String() string {
+    if m.Params == nil && m.Returns == "" {
+        return m.Name
+    }
+
+    params := make([]string, len(m.Params))
+    for idx, param := range m.Params {
+        params[idx] = strings.TrimSpace(param.Type + " " + param.Name)
+    }
+
+    str := m.Name + "(" + strings.Join(params, ", ") + ")"
+    if m.Returns != "" {
+        str += " -> " + m.Returns
+    }
+    return str
+}
+
+// parseMethodDescriptions accepts common replies of discovery methods:
+// array of method names (system.listMethods), array of objects with name and
+// params, object mapping names to params, and Neovim API info (object with
+// functions, possibly preceded by channel id).
+func parseMethodDescriptions(reply interface{}) ([]methodDescription, error) {
+    var methods []methodDescription
+
+    switch reply := reply.(type) {
+    case []interface{}:
+        if len(reply) == 2 {
+            if info, ok := reply[1].(map[string]interface{}); ok && info["functions"] != nil {
+                return parseMethodDescriptions(info)
+            }
+        }
+        for _, elem := range reply {
+            method, err := parseMethodDescription("", elem)
+            if err != nil {
+                return nil, err
+            }
+            methods = append(methods, method)
+        }
+    case map[string]interface{}:
+        if functions, ok := reply["functions"]; ok {
+            return parseMethodDescriptions(functions)
+        }
+        for name, elem := range reply {
+            method, err := parseMethodDescription(name, elem)
+            if err != nil {
+                return nil, err
+            }
+            methods = append(methods, method)
+        }
+    default:
+        return nil, errUnsupportedDescription
+    }
+
+    sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+    return methods, nil
+}
+
+// parseMethodDescription parses method name, object describing method or its
+// params.
+func parseMethodDescription(name string, value interface{}) (method methodDescription, err error) {
+    method.Name = name
+
+    switch value := value.(type) {
+    case string:
+        if name == "" {
+            method.Name = value
+            return method, nil
+        }
+    case []interface{}:
+        method.Params, err = parseMethodParams(value)
+        return method, err
+    case map[string]interface{}:
+        if n, ok := value["name"].(string); ok {
+            method.Name = n
+        }
+        for _, key := range []string{"params", "parameters", "args"} {
+            if params, ok := value[key].([]interface{}); ok {
+                if method.Params, err = parseMethodParams(params); err != nil {
+                    return method, err
+                }
+                break
+            }
+        }
+        for _, key := range []string{"returns", "return_type", "result"} {
+            if returns, ok := value[key].(string); ok {
+                method.Returns = returns
+                break
+            }
+        }
+    }
+
+    if method.Name == "" {
+        return method, errUnsupportedDescription
+    }
+    return method, nil
+}
+
+// parseMethodParams parses params given as names, pairs [type, name] (as in
+// Neovim API) or objects with name and type.
+func parseMethodParams(values []interface{}) ([]methodParam, error) {
+    params := make([]methodParam, len(values))
+
+    for idx, value := range values {
+        switch value := value.(type) {
+        case string:
+            params[idx].Name = value
+        case []interface{}:
+            if len(value) != 2 {
+                return nil, errUnsupportedDescription
+            }
+            params[idx].Type, _ = value[0].(string)
+            params[idx].Name, _ = value[1].(string)
+        case map[string]interface{}:
+            params[idx].Name, _ = value["name"].(string)
+            params[idx].Type, _ = value["type"].(string)
+        default:
+            return nil, errUnsupportedDescription
+        }
+    }
+
+    return params, nil
+}
+
+// methodsCache is content of cache file. Methods are valid only for the same
+// server and discovery method.
+type methodsCache struct {
+    Host      string              `json:"host"`
+    Port      string              `json:"port"`
+    Discovery string              `json:"discovery"`
+    Methods   []methodDescription `json:"methods"`
+}
+
+// readCachedMethods returns methods from cache file, or nil if it doesn't
+// exist, it's invalid, older than ttl or written for other host, port or
+// discovery method.
+func readCachedMethods(filename string, ttl time.Duration, host, port, discovery string) []methodDescription {
+    info, err := os.Stat(filename)
+    if err != nil || time.Since(info.ModTime()) > ttl {
+        return nil
+    }
+
+    data, err := ioutil.ReadFile(filename)
+    if err != nil {
+        return nil
+    }
+
+    var cache methodsCache
+    if err = json.Unmarshal(data, &cache); err != nil {
+        return nil
+    }
+    if cache.Host != host || cache.Port != port || cache.Discovery != discovery {
+        return nil
+    }
+    return cache.Methods
+}
+
+func writeCachedMethods(filename string, methods []methodDescription, host, port, discovery string) error {
+    data, err := encodeRPCReply(methodsCache{host, port, discovery, methods}, false)
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(filename, []byte(data), 0644)
+}
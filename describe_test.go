@@ -0,0 +1,84 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "path/filepath"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestParseMethodDescriptions(t *testing.T) {
+    cases := []struct {
+        reply    string
+        expected []string
+    }{
+        {`["b", "a"]`, []string{"a", "b"}},
+        {`[1, {"functions": [{"name": "nvim_command", "parameters": [["String", "command"]],
+            "return_type": "void"}]}]`, []string{"nvim_command(String command) -> void"}},
+        {`[{"name": "sum", "params": [{"name": "a", "type": "int"}, "b"]}]`, []string{"sum(int a, b)"}},
+        {`{"ping": [], "echo": ["message"]}`, []string{"echo(message)", "ping()"}},
+    }
+
+    for _, c := range cases {
+        reply, err := decodeRPCParams(c.reply, true)
+        if err != nil {
+            t.Fatal(err)
+        }
+        methods, err := parseMethodDescriptions(reply)
+        if err != nil {
+            t.Fatalf("Description %s wasn't parsed: %s", c.reply, err)
+        }
+        if len(methods) != len(c.expected) {
+            t.Fatalf("Description %s was parsed to %v", c.reply, methods)
+        }
+        for idx, method := range methods {
+            if method.String() != c.expected[idx] {
+                t.Fatalf("Description %s was parsed to %v", c.reply, methods)
+            }
+        }
+    }
+
+    for _, reply := range []interface{}{"methods", []interface{}{int64(1)}} {
+        if _, err := parseMethodDescriptions(reply); err == nil {
+            t.Fatalf("Unsupported description %#v was parsed", reply)
+        }
+    }
+}
+
+func TestCachedMethodsAreKeyedByServer(t *testing.T) {
+    filename := filepath.Join(tempDir(t), "methods.json")
+    methods := []methodDescription{{Name: "echo", Params: []methodParam{{Name: "text", Type: "string"}}}}
+
+    if err := writeCachedMethods(filename, methods, "localhost", "8000", "system.describe"); err != nil {
+        t.Fatal(err)
+    }
+
+    cached := readCachedMethods(filename, time.Hour, "localhost", "8000", "system.describe")
+    if !reflect.DeepEqual(cached, methods) {
+        t.Fatalf("Cached methods are %#v, expected %#v", cached, methods)
+    }
+
+    for _, key := range [][3]string{
+        {"otherhost", "8000", "system.describe"},
+        {"localhost", "8001", "system.describe"},
+        {"localhost", "8000", "system.listMethods"},
+    } {
+        if cached = readCachedMethods(filename, time.Hour, key[0], key[1], key[2]); cached != nil {
+            t.Fatalf("Methods cached for other server were read for %v", key)
+        }
+    }
+}
@@ -0,0 +1,390 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "github.com/jakm/msgpack-cli/convert"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+var errTruncatedMsgpack = errors.New("Truncated msgpack object")
+
+// editKind is kind of editing operation.
+type editKind int
+
+const (
+    editSet editKind = iota
+    editAppend
+    editDelete
+)
+
+// editOperation changes value at path of msgpack object. Value of set and
+// append is already encoded to msgpack.
+type editOperation struct {
+    kind  editKind
+    path  []interface{}
+    value []byte
+}
+
+// EditMsgpack applies operations to every msgpack object in input file (- for
+// STDIN) and writes the result to output file, or back to input file if
+// output file is empty. Only bytes of changed values and headers of changed
+// containers are rewritten, other bytes are kept as they are.
+func EditMsgpack(inFilename, outFilename string, operations []editOperation) error {
+    var (
+        data []byte
+        err  error
+    )
+
+    if inFilename == "-" {
+        data, err = ioutil.ReadAll(os.Stdin)
+    } else {
+        data, err = ioutil.ReadFile(inFilename)
+    }
+    if err != nil {
+        return err
+    }
+
+    var output []byte
+    for len(data) > 0 {
+        end, err := msgpackObjectEnd(data, 0)
+        if err != nil {
+            return decodeError(err)
+        }
+        object := data[:end]
+        for _, operation := range operations {
+            if object, err = editObject(object, operation, 0); err != nil {
+                return err
+            }
+        }
+        output = append(output, object...)
+        data = data[end:]
+    }
+
+    switch {
+    case outFilename != "":
+        return ioutil.WriteFile(outFilename, output, 0666)
+    case inFilename == "-":
+        _, err = os.Stdout.Write(output)
+        return err
+    default:
+        return replaceFile(inFilename, output)
+    }
+}
+
+// replaceFile writes data to temporary file and renames it to filename, so
+// that the file isn't left half written.
+func replaceFile(filename string, data []byte) error {
+    info, err := os.Stat(filename)
+    if err != nil {
+        return err
+    }
+
+    file, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+    if err != nil {
+        return err
+    }
+    defer os.Remove(file.Name())
+
+    if _, err = file.Write(data); err != nil {
+        file.Close()
+        return err
+    }
+    if err = file.Close(); err != nil {
+        return err
+    }
+    if err = os.Chmod(file.Name(), info.Mode()); err != nil {
+        return err
+    }
+    return os.Rename(file.Name(), filename)
+}
+
+// parseEditOperation parses operation given as <path>=<value>, or as <path>
+// if it's deletion. Value is JSON, other text is taken as string.
+func parseEditOperation(kind editKind, spec string) (editOperation, error) {
+    operation := editOperation{kind: kind}
+
+    path := spec
+    if kind != editDelete {
+        parts := strings.SplitN(spec, "=", 2)
+        if len(parts) != 2 {
+            return operation, usageError(fmt.Errorf("Invalid operation %s, expected <path>=<value>", spec))
+        }
+        path = parts[0]
+
+        value, err := decodeRPCParams(parts[1], true)
+        if err != nil {
+            value = parts[1]
+        }
+        if operation.value, err = convert.EncodeMsgpack(value); err != nil {
+            return operation, err
+        }
+    }
+
+    var err error
+    if operation.path, err = parseJSONPath(path); err != nil {
+        return operation, usageError(err)
+    }
+    if kind == editDelete && len(operation.path) == 0 {
+        return operation, usageError(fmt.Errorf("Root object can't be deleted"))
+    }
+
+    return operation, nil
+}
+
+// editObject returns object with operation applied to value at
+// operation.path[depth:].
+func editObject(object []byte, operation editOperation, depth int) ([]byte, error) {
+    path := operation.path[depth:]
+
+    if len(path) == 0 {
+        switch operation.kind {
+        case editSet:
+            return operation.value, nil
+        case editAppend:
+            isMap, count, header, ok := msgpackContainer(object)
+            if !ok || isMap {
+                return nil, fmt.Errorf("Value at path %s isn't an array", formatJSONPath(operation.path))
+            }
+            edited := appendContainerHeader(nil, object[0], false, count+1)
+            edited = append(edited, object[header:]...)
+            return append(edited, operation.value...), nil
+        }
+    }
+
+    isMap, count, header, ok := msgpackContainer(object)
+    if !ok {
+        return nil, fmt.Errorf("Value at path %s isn't a map or an array", formatJSONPath(operation.path[:depth]))
+    }
+
+    // find element at path[0] and offsets of its value
+    start, end, found := header, header, false
+    for idx := 0; idx < count && !found; idx++ {
+        keyEnd := start
+        if isMap {
+            var err error
+            if keyEnd, err = msgpackObjectEnd(object, start); err != nil {
+                return nil, decodeError(err)
+            }
+            found = matchMapKey(object[start:keyEnd], path[0])
+        } else {
+            found = path[0] == idx
+        }
+
+        valueEnd, err := msgpackObjectEnd(object, keyEnd)
+        if err != nil {
+            return nil, decodeError(err)
+        }
+        if found {
+            if len(path) > 1 || operation.kind != editDelete {
+                // keep the key, edit only value
+                start = keyEnd
+            }
+            end = valueEnd
+        } else {
+            start = valueEnd
+        }
+    }
+    if !found {
+        end = start
+    }
+
+    var replacement []byte
+    switch {
+    case found && len(path) == 1 && operation.kind == editDelete:
+        count--
+    case found:
+        value, err := editObject(object[start:end], operation, depth+1)
+        if err != nil {
+            return nil, err
+        }
+        replacement = value
+    case isMap && operation.kind == editSet:
+        // missing keys are added, with maps of the rest of path
+        entry, err := newMapEntry(path, operation.value)
+        if err != nil {
+            return nil, fmt.Errorf("Path %s not found", formatJSONPath(operation.path))
+        }
+        replacement = entry
+        count++
+    default:
+        return nil, fmt.Errorf("Path %s not found", formatJSONPath(operation.path))
+    }
+
+    edited := appendContainerHeader(nil, object[0], isMap, count)
+    edited = append(edited, object[header:start]...)
+    edited = append(edited, replacement...)
+    return append(edited, object[end:]...), nil
+}
+
+// matchMapKey returns true if encoded key equals elem of path, string elems
+// match string keys and int elems match integer keys.
+func matchMapKey(key []byte, elem interface{}) bool {
+    var value interface{}
+    if convert.DecodeMsgpack(key, &value) != nil {
+        return false
+    }
+
+    switch value := value.(type) {
+    case string:
+        return value == elem
+    case int64:
+        return elem == int(value)
+    case uint64:
+        n, ok := elem.(int)
+        return ok && uint64(n) == value
+    }
+    return false
+}
+
+// newMapEntry returns key path[0] and value encoded to msgpack. If path is
+// longer, value is wrapped to maps with the rest of keys.
+func newMapEntry(path []interface{}, value []byte) ([]byte, error) {
+    for idx := len(path) - 1; idx >= 0; idx-- {
+        key, ok := path[idx].(string)
+        if !ok {
+            return nil, fmt.Errorf("Array index %d in path of new value", path[idx])
+        }
+        encoded, err := convert.EncodeMsgpack(key)
+        if err != nil {
+            return nil, err
+        }
+        if idx == 0 {
+            return append(encoded, value...), nil
+        }
+        value = append(appendContainerHeader(nil, 0x80, true, 1), append(encoded, value...)...)
+    }
+    return value, nil
+}
+
+// msgpackContainer returns kind, number of elements and length of header of
+// encoded map or array. Number of elements of map is number of its entries.
+func msgpackContainer(object []byte) (isMap bool, count, header int, ok bool) {
+    if len(object) == 0 {
+        return false, 0, 0, false
+    }
+
+    switch b := object[0]; {
+    case b >= 0x80 && b <= 0x8f:
+        return true, int(b & 0x0f), 1, true
+    case b >= 0x90 && b <= 0x9f:
+        return false, int(b & 0x0f), 1, true
+    case (b == 0xdc || b == 0xde) && len(object) >= 3:
+        return b == 0xde, int(binary.BigEndian.Uint16(object[1:])), 3, true
+    case (b == 0xdd || b == 0xdf) && len(object) >= 5:
+        return b == 0xdf, int(binary.BigEndian.Uint32(object[1:])), 5, true
+    }
+    return false, 0, 0, false
+}
+
+// appendContainerHeader appends header of map or array with count elements.
+// Format of the original header is kept unless count doesn't fit in it.
+func appendContainerHeader(dst []byte, original byte, isMap bool, count int) []byte {
+    fixed, header16, header32 := byte(0x90), byte(0xdc), byte(0xdd)
+    if isMap {
+        fixed, header16, header32 = 0x80, 0xde, 0xdf
+    }
+
+    switch {
+    case count <= 0x0f && original&0xf0 == fixed:
+        return append(dst, fixed|byte(count))
+    case count <= 0xffff && original != header32:
+        return append(dst, header16, byte(count>>8), byte(count))
+    default:
+        return append(dst, header32, byte(count>>24), byte(count>>16), byte(count>>8), byte(count))
+    }
+}
+
+// msgpackObjectEnd returns offset of the end of msgpack object starting at
+// offset start of data.
+func msgpackObjectEnd(data []byte, start int) (int, error) {
+    pos := start
+    for remaining := 1; remaining > 0; remaining-- {
+        if pos >= len(data) {
+            return 0, errTruncatedMsgpack
+        }
+
+        b := data[pos]
+        size, length, children := 1, 0, 0
+        switch {
+        case b <= 0x7f || b >= 0xe0 || b == 0xc0 || b == 0xc2 || b == 0xc3:
+        case b <= 0x8f:
+            children = 2 * int(b&0x0f)
+        case b <= 0x9f:
+            children = int(b & 0x0f)
+        case b <= 0xbf:
+            length = int(b & 0x1f)
+        case b == 0xc4 || b == 0xd9:
+            size, length = 2, int(lengthAt(data, pos+1, 1))
+        case b == 0xc5 || b == 0xda:
+            size, length = 3, int(lengthAt(data, pos+1, 2))
+        case b == 0xc6 || b == 0xdb:
+            size, length = 5, int(lengthAt(data, pos+1, 4))
+        case b == 0xc7:
+            size, length = 3, int(lengthAt(data, pos+1, 1))
+        case b == 0xc8:
+            size, length = 4, int(lengthAt(data, pos+1, 2))
+        case b == 0xc9:
+            size, length = 6, int(lengthAt(data, pos+1, 4))
+        case b == 0xca || b == 0xce || b == 0xd2:
+            size = 5
+        case b == 0xcb || b == 0xcf || b == 0xd3:
+            size = 9
+        case b == 0xcc || b == 0xd0:
+            size = 2
+        case b == 0xcd || b == 0xd1:
+            size = 3
+        case b >= 0xd4 && b <= 0xd8:
+            // fixext with type and 1, 2, 4, 8 or 16 bytes
+            size = 2 + 1<<(b-0xd4)
+        case b == 0xdc || b == 0xde:
+            size, children = 3, int(lengthAt(data, pos+1, 2))
+            if b == 0xde {
+                children *= 2
+            }
+        case b == 0xdd || b == 0xdf:
+            size, children = 5, int(lengthAt(data, pos+1, 4))
+            if b == 0xdf {
+                children *= 2
+            }
+        default:
+            return 0, fmt.Errorf("Invalid msgpack byte 0x%02x at offset %d", b, pos)
+        }
+
+        pos += size + length
+        if pos > len(data) {
+            return 0, errTruncatedMsgpack
+        }
+        remaining += children
+    }
+    return pos, nil
+}
+
+// lengthAt returns big endian number of n bytes at offset pos of data, or
+// length of data if it's truncated.
+func lengthAt(data []byte, pos, n int) uint64 {
+    if pos+n > len(data) {
+        return uint64(len(data))
+    }
+    var buf [8]byte
+    copy(buf[8-n:], data[pos:pos+n])
+    return binary.BigEndian.Uint64(buf[:])
+}
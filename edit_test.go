@@ -0,0 +1,87 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestEditObjectKeepsUntouchedBytes(t *testing.T) {
+    // {"n": uint16 1, "b": bin "x", "e": ext 5, "l": [1]} with keys in this order
+    object := []byte("\x84\xa1n\xcd\x00\x01\xa1b\xc4\x01x\xa1e\xd4\x05\x00\xa1l\x91\x01")
+
+    cases := []struct {
+        kind     editKind
+        path     string
+        value    string
+        expected string
+    }{
+        {editSet, ".l[0]", "2", "\x84\xa1n\xcd\x00\x01\xa1b\xc4\x01x\xa1e\xd4\x05\x00\xa1l\x91\x02"},
+        {editSet, ".a.b", "true", "\x85\xa1n\xcd\x00\x01\xa1b\xc4\x01x\xa1e\xd4\x05\x00\xa1l\x91\x01\xa1a\x81\xa1b\xc3"},
+        {editAppend, ".l", "\"s\"", "\x84\xa1n\xcd\x00\x01\xa1b\xc4\x01x\xa1e\xd4\x05\x00\xa1l\x92\x01\xa1s"},
+        {editDelete, ".b", "", "\x83\xa1n\xcd\x00\x01\xa1e\xd4\x05\x00\xa1l\x91\x01"},
+        {editDelete, ".l[0]", "", "\x84\xa1n\xcd\x00\x01\xa1b\xc4\x01x\xa1e\xd4\x05\x00\xa1l\x90"},
+    }
+    for _, c := range cases {
+        spec := c.path
+        if c.kind != editDelete {
+            spec += "=" + c.value
+        }
+        operation, err := parseEditOperation(c.kind, spec)
+        if err != nil {
+            t.Fatal(err)
+        }
+        edited, err := editObject(object, operation, 0)
+        if err != nil {
+            t.Fatalf("Operation %s failed: %s", spec, err)
+        }
+        if !bytes.Equal(edited, []byte(c.expected)) {
+            t.Fatalf("Operation %s returned % x", spec, edited)
+        }
+    }
+
+    for _, spec := range []string{".missing", ".n.x", ".l[1]"} {
+        operation, _ := parseEditOperation(editDelete, spec)
+        if _, err := editObject(object, operation, 0); err == nil {
+            t.Fatalf("Invalid operation %s succeeded", spec)
+        }
+    }
+}
+
+func TestEditObjectGrowsHeader(t *testing.T) {
+    object := append([]byte{0x9f}, bytes.Repeat([]byte{0x00}, 15)...)
+    operation, _ := parseEditOperation(editAppend, "$=1")
+
+    edited, err := editObject(object, operation, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected := append(append([]byte{0xdc, 0x00, 0x10}, object[1:]...), 0x01)
+    if !bytes.Equal(edited, expected) {
+        t.Fatalf("Appended array is % x", edited)
+    }
+}
+
+func TestMsgpackObjectEnd(t *testing.T) {
+    data := []byte("\x82\xa1a\xdc\x00\x02\xcb\x00\x00\x00\x00\x00\x00\x00\x00\xc7\x01\x05x\xa1b\xd8\x01" +
+        "0123456789abcdef\xc0")
+    if end, err := msgpackObjectEnd(data, 0); err != nil || end != len(data)-1 {
+        t.Fatalf("Object ends at %d: %v", end, err)
+    }
+    if _, err := msgpackObjectEnd(data[:10], 0); err == nil {
+        t.Fatal("End of truncated object was found")
+    }
+}
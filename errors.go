@@ -0,0 +1,101 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "errors"
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/jakm/msgpack-cli/rpcclient"
+)
+
+// Exit codes of msgpack-cli, so that scripts can tell failures apart.
+// Interrupted has the conventional code of process terminated by SIGINT.
+const (
+    exitFailure     = 1
+    exitUsage       = 2
+    exitConnection  = 3
+    exitTimeout     = 4
+    exitRemote      = 5
+    exitDecode      = 6
+    exitInterrupted = 130
+)
+
+var (
+    errTimeout     = errors.New("RPC call timed out")
+    errInterrupted = errors.New("Interrupted")
+)
+
+type exitError struct {
+    code int
+    err  error
+}
+
+func (e *exitError) Error() string {
+    return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+    return e.err
+}
+
+func usageError(err error) error {
+    return &exitError{exitUsage, err}
+}
+
+func connectionError(err error) error {
+    return &exitError{exitConnection, err}
+}
+
+func timeoutError(err error) error {
+    return &exitError{exitTimeout, err}
+}
+
+func decodeError(err error) error {
+    return &exitError{exitDecode, err}
+}
+
+// contextError returns error of done context.
+func contextError(ctx context.Context) error {
+    if ctx.Err() == context.DeadlineExceeded {
+        return timeoutError(errTimeout)
+    }
+    return &exitError{exitInterrupted, errInterrupted}
+}
+
+func exitCode(err error) int {
+    var (
+        remoteErr *rpcclient.RemoteError
+        connErr   *rpcclient.ConnectionError
+        decodeErr *convert.DecodeError
+        exitErr   *exitError
+    )
+
+    switch {
+    case errors.As(err, &exitErr):
+        return exitErr.code
+    case errors.As(err, &remoteErr):
+        return exitRemote
+    case errors.As(err, &connErr):
+        if connErr.Timeout() {
+            return exitTimeout
+        }
+        return exitConnection
+    case errors.As(err, &decodeErr):
+        return exitDecode
+    }
+
+    return exitFailure
+}
@@ -0,0 +1,301 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "net"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type fanOutResult struct {
+    Host    string      `json:"host"`
+    Result  interface{} `json:"result"`
+    Error   interface{} `json:"error"`
+    Latency float64     `json:"latency"`
+}
+
+var hostRangePattern = regexp.MustCompile(`^(\d+)-(\d+)$`)
+
+// maxHosts limits number of endpoints expanded from host patterns.
+const maxHosts = 10000
+
+// FanOut calls method on every host (<host>:<port>) over its own connection,
+// at most options.inflight at once, and writes results to STDOUT as JSON lines
+// in order of completion. Latency of connecting and call is in milliseconds.
+func FanOut(ctx context.Context, hosts []string, method, params string, options Options) error {
+    args, err := getCallArgs(params, options)
+    if err != nil {
+        return err
+    }
+
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    results := make(chan fanOutResult)
+    slots := make(chan struct{}, options.inflight)
+
+    go func() {
+        for _, endpoint := range hosts {
+            select {
+            case slots <- struct{}{}:
+            case <-ctx.Done():
+                return
+            }
+            go func(endpoint string) {
+                res := callHost(ctx, endpoint, method, args, options)
+                <-slots
+                select {
+                case results <- res:
+                case <-ctx.Done():
+                }
+            }(endpoint)
+        }
+    }()
+
+    var failed []string
+
+    for n := 0; n < len(hosts); n++ {
+        var res fanOutResult
+        select {
+        case res = <-results:
+        case <-ctx.Done():
+            return contextError(ctx)
+        }
+
+        if res.Error != nil {
+            failed = append(failed, res.Host)
+        }
+
+        data, err := encodeRPCReply(res, false)
+        if err != nil {
+            return err
+        }
+        fmt.Print(data)
+    }
+
+    if len(failed) > 0 {
+        return fmt.Errorf("%d of %d hosts failed: %s", len(failed), len(hosts), strings.Join(failed, ", "))
+    }
+    return nil
+}
+
+func callHost(ctx context.Context, endpoint, method string, args interface{}, options Options) fanOutResult {
+    res := fanOutResult{Host: endpoint}
+    start := time.Now()
+
+    host, port, _ := net.SplitHostPort(endpoint)
+    conn, err := dialRPC(ctx, host, port, options)
+    if err != nil {
+        res.Error = err.Error()
+        res.Latency = milliseconds(time.Since(start))
+        return res
+    }
+    client := rpcclient.NewClient(conn, nil, nil)
+    defer client.Close()
+
+    ctx, cancel := withTimeout(ctx, options.timeout)
+    defer cancel()
+
+    stop := closeIfCancelled(ctx, client)
+    call := client.Go(method, args, nil)
+    stop()
+
+    select {
+    case <-call.Done:
+        switch {
+        case call.Err != nil:
+            res.Error = call.Err.Error()
+        case call.RemoteErr != nil:
+            res.Error = call.RemoteErr
+        default:
+            res.Result = call.Reply
+        }
+    case <-ctx.Done():
+        res.Error = contextError(ctx).Error()
+    }
+
+    res.Latency = milliseconds(time.Since(start))
+    return res
+}
+
+// expandHosts returns endpoints <host>:<port> given by comma separated
+// patterns, or by file (- for STDIN) with one pattern per line if spec starts
+// with @. Patterns may contain alternatives {a,b} and numeric ranges [1-12],
+// at most maxHosts endpoints can be given.
+func expandHosts(spec string) ([]string, error) {
+    var patterns []string
+
+    if strings.HasPrefix(spec, "@") {
+        file := os.Stdin
+        if filename := spec[1:]; filename != "-" {
+            var err error
+            if file, err = os.Open(filename); err != nil {
+                return nil, err
+            }
+            defer file.Close()
+        }
+
+        scanner := bufio.NewScanner(file)
+        for scanner.Scan() {
+            line := strings.TrimSpace(scanner.Text())
+            if line != "" && !strings.HasPrefix(line, "#") {
+                patterns = append(patterns, line)
+            }
+        }
+        if err := scanner.Err(); err != nil {
+            return nil, err
+        }
+    } else {
+        patterns = splitOutsideBraces(spec)
+    }
+
+    var hosts []string
+    for _, pattern := range patterns {
+        expanded, err := expandHostPattern(pattern)
+        if err != nil {
+            return nil, usageError(err)
+        }
+        for _, endpoint := range expanded {
+            if _, _, err = net.SplitHostPort(endpoint); err != nil {
+                return nil, usageError(err)
+            }
+        }
+        if hosts = append(hosts, expanded...); len(hosts) > maxHosts {
+            return nil, usageError(tooManyHosts())
+        }
+    }
+
+    if len(hosts) == 0 {
+        return nil, usageError(fmt.Errorf("No hosts given"))
+    }
+    return hosts, nil
+}
+
+// expandHostPattern expands the first alternatives or range in pattern and
+// the rest of it recursively.
+func expandHostPattern(pattern string) ([]string, error) {
+    for idx, char := range pattern {
+        switch char {
+        case '{':
+            end := matchingBrace(pattern, idx)
+            if end < 0 {
+                return nil, fmt.Errorf("Unbalanced braces in %s", pattern)
+            }
+            var hosts []string
+            for _, alternative := range splitOutsideBraces(pattern[idx+1 : end]) {
+                expanded, err := expandHostPattern(pattern[:idx] + alternative + pattern[end+1:])
+                if err != nil {
+                    return nil, err
+                }
+                if hosts = append(hosts, expanded...); len(hosts) > maxHosts {
+                    return nil, tooManyHosts()
+                }
+            }
+            return hosts, nil
+        case '[':
+            end := strings.IndexByte(pattern[idx:], ']')
+            if end < 0 {
+                continue
+            }
+            end += idx
+            // other brackets are left as they are, e.g. in IPv6 address
+            bounds := hostRangePattern.FindStringSubmatch(pattern[idx+1 : end])
+            if bounds == nil {
+                continue
+            }
+            first, err := strconv.Atoi(bounds[1])
+            if err != nil {
+                return nil, fmt.Errorf("Invalid range in %s", pattern)
+            }
+            last, err := strconv.Atoi(bounds[2])
+            if err != nil || first > last {
+                return nil, fmt.Errorf("Invalid range in %s", pattern)
+            }
+            if last-first >= maxHosts {
+                return nil, tooManyHosts()
+            }
+            // leading zeros of the first bound set width of numbers
+            format := "%d"
+            if len(bounds[1]) > 1 && bounds[1][0] == '0' {
+                format = "%0" + strconv.Itoa(len(bounds[1])) + "d"
+            }
+            rest, err := expandHostPattern(pattern[end+1:])
+            if err != nil {
+                return nil, err
+            }
+            if (last-first+1)*len(rest) > maxHosts {
+                return nil, tooManyHosts()
+            }
+            var hosts []string
+            for n := first; n <= last; n++ {
+                for _, suffix := range rest {
+                    hosts = append(hosts, pattern[:idx]+fmt.Sprintf(format, n)+suffix)
+                }
+            }
+            return hosts, nil
+        }
+    }
+    return []string{pattern}, nil
+}
+
+func tooManyHosts() error {
+    return fmt.Errorf("Too many hosts, at most %d can be given", maxHosts)
+}
+
+func matchingBrace(pattern string, start int) int {
+    depth := 0
+    for idx := start; idx < len(pattern); idx++ {
+        switch pattern[idx] {
+        case '{':
+            depth++
+        case '}':
+            if depth--; depth == 0 {
+                return idx
+            }
+        }
+    }
+    return -1
+}
+
+// splitOutsideBraces splits str by commas that are not enclosed in braces.
+func splitOutsideBraces(str string) []string {
+    var (
+        parts []string
+        depth int
+        start int
+    )
+    for idx := 0; idx < len(str); idx++ {
+        switch str[idx] {
+        case '{':
+            depth++
+        case '}':
+            depth--
+        case ',':
+            if depth == 0 {
+                parts = append(parts, str[start:idx])
+                start = idx + 1
+            }
+        }
+    }
+    return append(parts, str[start:])
+}
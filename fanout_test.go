@@ -0,0 +1,44 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestExpandHosts(t *testing.T) {
+    hosts, err := expandHosts("app-[08-10].{eu,us}:8000,[::1]:9000")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := []string{
+        "app-08.eu:8000", "app-08.us:8000", "app-09.eu:8000", "app-09.us:8000",
+        "app-10.eu:8000", "app-10.us:8000", "[::1]:9000",
+    }
+    if !reflect.DeepEqual(hosts, expected) {
+        t.Fatalf("Hosts were expanded to %v", hosts)
+    }
+
+    for _, spec := range []string{
+        "app:{1,2", "app-[3-1]:80", "app", "", "app-[1-99999999999999999999]:80",
+        "app-[1-10001]:80", "app-[1-100]-[1-101]:80", "{a,b}-[1-5001]:80",
+    } {
+        if _, err = expandHosts(spec); exitCode(err) != exitUsage {
+            t.Fatalf("Invalid hosts %s were accepted", spec)
+        }
+    }
+}
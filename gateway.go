@@ -0,0 +1,152 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "io/ioutil"
+    "log"
+    "net/http"
+    "strings"
+    "sync"
+)
+
+const gatewayPrefix = "/rpc/"
+
+// gateway translates HTTP requests to calls of RPC server. All requests share
+// single connection, which is opened again when it's closed.
+type gateway struct {
+    host    string
+    port    string
+    options Options
+    mutex   sync.Mutex
+    client  rpcclient.Client
+}
+
+type gatewayError struct {
+    Error interface{} `json:"error"`
+}
+
+// Gateway listens on address for HTTP requests POST /rpc/<method> with JSON
+// params in body and calls the method of RPC server. Result is returned as
+// JSON, error as JSON object {"error": ...} with status 500 if it was returned
+// by server, 502 if server is unreachable and 504 if the call timed out.
+// Gateway stops when ctx is done.
+func Gateway(ctx context.Context, address, host, port string, options Options) error {
+    g := &gateway{host: host, port: port, options: options}
+
+    mux := http.NewServeMux()
+    mux.Handle(gatewayPrefix, g)
+
+    server := &http.Server{Addr: address, Handler: mux}
+    go closeWhenDone(ctx, server)
+
+    if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+        return connectionError(err)
+    }
+    return nil
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        g.writeJSON(w, http.StatusMethodNotAllowed, gatewayError{"Method not allowed"})
+        return
+    }
+
+    method := strings.TrimPrefix(r.URL.Path, gatewayPrefix)
+    if method == "" {
+        g.writeJSON(w, http.StatusNotFound, gatewayError{"Missing RPC method"})
+        return
+    }
+
+    body, err := ioutil.ReadAll(r.Body)
+    if err != nil {
+        g.writeJSON(w, http.StatusBadRequest, gatewayError{err.Error()})
+        return
+    }
+
+    args, err := decodeRPCParams(wrapJSONParams(body), g.options.convertToInt64)
+    if err != nil {
+        g.writeJSON(w, http.StatusBadRequest, gatewayError{err.Error()})
+        return
+    }
+
+    ctx, cancel := withTimeout(r.Context(), g.options.timeout)
+    defer cancel()
+
+    client, err := g.getClient(ctx)
+    if err != nil {
+        g.writeJSON(w, http.StatusBadGateway, gatewayError{err.Error()})
+        return
+    }
+
+    stop := closeIfCancelled(ctx, client)
+    call := client.Go(method, args, nil)
+    stop()
+
+    select {
+    case <-call.Done:
+        switch {
+        case call.Err != nil:
+            g.writeJSON(w, http.StatusBadGateway, gatewayError{call.Err.Error()})
+        case call.RemoteErr != nil:
+            g.writeJSON(w, http.StatusInternalServerError, gatewayError{call.RemoteErr})
+        default:
+            g.writeJSON(w, http.StatusOK, call.Reply)
+        }
+    case <-ctx.Done():
+        if ctx.Err() == context.DeadlineExceeded {
+            g.writeJSON(w, http.StatusGatewayTimeout, gatewayError{errTimeout.Error()})
+        }
+    }
+}
+
+// getClient returns connected client, it dials RPC server if necessary.
+func (g *gateway) getClient(ctx context.Context) (rpcclient.Client, error) {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+
+    if g.client != nil {
+        select {
+        case <-g.client.Done():
+            g.client = nil
+        default:
+            return g.client, nil
+        }
+    }
+
+    conn, err := dialRPC(ctx, g.host, g.port, g.options)
+    if err != nil {
+        return nil, err
+    }
+    g.client = rpcclient.NewClient(conn, nil, nil)
+
+    return g.client, nil
+}
+
+func (g *gateway) writeJSON(w http.ResponseWriter, status int, object interface{}) {
+    data, err := encodeRPCReply(object, g.options.indent)
+    if err != nil {
+        log.Print(err)
+        status = http.StatusInternalServerError
+        data = "{\"error\":\"Encoding of reply failed\"}\n"
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    w.Write([]byte(data))
+}
@@ -0,0 +1,74 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestGatewayStatuses(t *testing.T) {
+    // nothing listens on the address, so reconnection fails
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    host, port, _ := net.SplitHostPort(listener.Addr().String())
+    listener.Close()
+
+    clientConn, serverConn := net.Pipe()
+    go serveEcho(serverConn)
+
+    g := &gateway{host: host, port: port, options: Options{timeout: 50 * time.Millisecond}}
+    g.client = rpcclient.NewClient(clientConn, nil, nil)
+
+    for _, test := range []struct {
+        method string
+        path   string
+        body   string
+        status int
+        reply  string
+        closed bool
+    }{
+        {http.MethodPost, "/rpc/echo", `["a", 1]`, http.StatusOK, `["a",1]`, false},
+        {http.MethodPost, "/rpc/fail", `[]`, http.StatusInternalServerError, `{"error":"boom"}`, false},
+        {http.MethodPost, "/rpc/sleep", `[]`, http.StatusGatewayTimeout, `{"error":"RPC call timed out"}`, false},
+        {http.MethodPost, "/rpc/echo", `[`, http.StatusBadRequest, "", false},
+        {http.MethodPost, "/rpc/", `[]`, http.StatusNotFound, `{"error":"Missing RPC method"}`, false},
+        {http.MethodGet, "/rpc/echo", "", http.StatusMethodNotAllowed, `{"error":"Method not allowed"}`, false},
+        {http.MethodPost, "/rpc/echo", `[]`, http.StatusBadGateway, "", true},
+    } {
+        if test.closed {
+            g.client.Close()
+        }
+
+        request := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+        recorder := httptest.NewRecorder()
+        g.ServeHTTP(recorder, request)
+
+        if recorder.Code != test.status {
+            t.Fatalf("%s %s returned status %d, expected %d: %s", test.method, test.path,
+                recorder.Code, test.status, recorder.Body)
+        }
+        if reply := strings.TrimSpace(recorder.Body.String()); test.reply != "" && reply != test.reply {
+            t.Fatalf("%s %s returned %s, expected %s", test.method, test.path, reply, test.reply)
+        }
+    }
+}
@@ -0,0 +1,219 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "go/format"
+    "go/token"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// goInitialisms are written in upper case in Go names.
+var goInitialisms = map[string]bool{
+    "api": true, "cpu": true, "html": true, "http": true, "https": true, "id": true, "ip": true,
+    "json": true, "sql": true, "tcp": true, "ttl": true, "udp": true, "uri": true, "url": true,
+    "utc": true, "uuid": true, "xml": true,
+}
+
+// goTypeGenerator collects Go definitions of inferred types.
+type goTypeGenerator struct {
+    definitions []string
+    names       map[string]bool
+    imports     map[string]bool
+}
+
+// GenerateTypes infers type of msgpack objects in sample files (- for STDIN)
+// and writes Go definition of it named options.typeName to STDOUT, with
+// structs for maps. Fields missing in some samples or null are optional,
+// integers have the smallest width holding observed values and different
+// types at one place are merged to interface{}.
+func GenerateTypes(filenames []string, options Options) error {
+    if !token.IsIdentifier(options.typeName) {
+        return usageError(fmt.Errorf("Invalid type name %s", options.typeName))
+    }
+    if !token.IsIdentifier(options.packageName) || options.packageName == "_" {
+        return usageError(fmt.Errorf("Invalid package name %s", options.packageName))
+    }
+
+    root, err := inferSamples(filenames)
+    if err != nil {
+        return err
+    }
+    if root.count == 0 {
+        return decodeError(fmt.Errorf("No samples found"))
+    }
+
+    source, err := generateGoTypes(root, options.typeName, options.packageName)
+    if err != nil {
+        return err
+    }
+    _, err = os.Stdout.Write(source)
+    return err
+}
+
+// generateGoTypes returns formatted Go source with definition of type t named
+// typeName.
+func generateGoTypes(root *inferredType, typeName, packageName string) ([]byte, error) {
+    g := &goTypeGenerator{names: make(map[string]bool), imports: make(map[string]bool)}
+    g.definitions = append(g.definitions, "")
+    if typ, comment := g.goType(root, typeName, false); typ != typeName {
+        g.names[typeName] = true
+        g.definitions[0] = fmt.Sprintf("type %s %s", typeName, typ)
+        if comment != "" {
+            g.definitions[0] += " // " + comment
+        }
+        g.definitions[0] += "\n"
+    } else {
+        g.definitions = g.definitions[1:]
+    }
+
+    var source bytes.Buffer
+    fmt.Fprintf(&source, "package %s\n\n", packageName)
+    if len(g.imports) > 0 {
+        imports := make([]string, 0, len(g.imports))
+        for path := range g.imports {
+            imports = append(imports, strconv.Quote(path))
+        }
+        sort.Strings(imports)
+        fmt.Fprintf(&source, "import (\n%s\n)\n\n", strings.Join(imports, "\n"))
+    }
+    source.WriteString(strings.Join(g.definitions, "\n"))
+
+    return format.Source(source.Bytes())
+}
+
+// goType returns Go type of t and comment describing union of types. Maps are
+// defined as structs named by name.
+func (g *goTypeGenerator) goType(t *inferredType, name string, optional bool) (typ, comment string) {
+    switch {
+    case t.kinds() == 0:
+        return "interface{}", ""
+    case t.kinds() > 1 && !t.numeric():
+        return "interface{}", "one of " + strings.Join(t.kindNames(), ", ")
+    case t.floats > 0:
+        typ = "float64"
+    case t.ints > 0 && t.maxUint > 0 && t.minInt < 0:
+        // no integer type holds both
+        return "interface{}", "one of int64, uint64"
+    case t.ints > 0:
+        typ = goIntType(t)
+    case t.bools > 0:
+        typ = "bool"
+    case t.strings > 0:
+        typ = "string"
+    case t.binaries > 0:
+        return "[]byte", ""
+    case t.times > 0:
+        g.imports["time"] = true
+        typ = "time.Time"
+    case t.exts > 0:
+        g.imports["github.com/ugorji/go/codec"] = true
+        typ = "codec.RawExt"
+    case t.arrays > 0:
+        elem, comment := g.goType(t.elem, name+"Item", t.elem.nulls > 0)
+        return "[]" + elem, comment
+    case t.maps > 0:
+        typ = g.defineStruct(t, name)
+    }
+
+    if optional {
+        typ = "*" + typ
+    }
+    return typ, ""
+}
+
+// defineStruct adds definition of struct with fields of t and returns its
+// name, which is made unique.
+func (g *goTypeGenerator) defineStruct(t *inferredType, name string) string {
+    for n := 2; g.names[name]; n++ {
+        name = strings.TrimRightFunc(name, unicode.IsDigit) + strconv.Itoa(n)
+    }
+    g.names[name] = true
+
+    idx := len(g.definitions)
+    g.definitions = append(g.definitions, "")
+
+    var definition bytes.Buffer
+    fmt.Fprintf(&definition, "type %s struct {\n", name)
+
+    fieldNames := make(map[string]bool)
+    for _, key := range t.fieldNames() {
+        field := t.fields[key]
+
+        fieldName := goName(key)
+        for n := 2; fieldNames[fieldName]; n++ {
+            fieldName = goName(key) + strconv.Itoa(n)
+        }
+        fieldNames[fieldName] = true
+
+        optional := !t.required(key) || field.nulls > 0
+        typ, comment := g.goType(field, name+fieldName, optional)
+
+        tag := key
+        if optional {
+            tag += ",omitempty"
+        }
+        fmt.Fprintf(&definition, "%s %s `codec:%s`", fieldName, typ, strconv.Quote(tag))
+        if comment != "" {
+            fmt.Fprintf(&definition, " // %s", comment)
+        }
+        definition.WriteString("\n")
+    }
+
+    definition.WriteString("}\n")
+    g.definitions[idx] = definition.String()
+    return name
+}
+
+// goIntType returns the smallest integer type holding observed integers.
+func goIntType(t *inferredType) string {
+    if t.maxUint > 0 {
+        return "uint64"
+    }
+    for _, bits := range []uint{8, 16, 32} {
+        if t.minInt >= -1<<(bits-1) && t.maxInt <= 1<<(bits-1)-1 {
+            return "int" + strconv.Itoa(int(bits))
+        }
+    }
+    return "int64"
+}
+
+// goName converts key to exported Go name, e.g. user_id to UserID.
+func goName(key string) string {
+    parts := strings.FieldsFunc(key, func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+    })
+
+    var name strings.Builder
+    for _, part := range parts {
+        if goInitialisms[strings.ToLower(part)] {
+            name.WriteString(strings.ToUpper(part))
+        } else {
+            runes := []rune(part)
+            name.WriteString(string(unicode.ToUpper(runes[0])) + string(runes[1:]))
+        }
+    }
+
+    if name.Len() == 0 || !unicode.IsLetter([]rune(name.String())[0]) {
+        return "F" + name.String()
+    }
+    return name.String()
+}
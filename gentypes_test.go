@@ -0,0 +1,101 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "io/ioutil"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestGenerateGoTypes(t *testing.T) {
+    root := newInferredType()
+    root.observe(map[string]interface{}{
+        "user_id": int64(1), "temp": int64(21), "pos": map[string]interface{}{"x": int64(-1)},
+        "v": int64(1), "meta": nil,
+    })
+    root.observe(map[string]interface{}{
+        "user_id": int64(70000), "temp": 19.5, "pos": map[string]interface{}{"x": int64(200)},
+        "v": "one", "url": "http://x",
+    })
+
+    source, err := generateGoTypes(root, "Reading", "telemetry")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := "package telemetry\n\n" +
+        "type Reading struct {\n" +
+        "\tMeta   interface{} `codec:\"meta,omitempty\"`\n" +
+        "\tPos    ReadingPos  `codec:\"pos\"`\n" +
+        "\tTemp   float64     `codec:\"temp\"`\n" +
+        "\tURL    *string     `codec:\"url,omitempty\"`\n" +
+        "\tUserID int32       `codec:\"user_id\"`\n" +
+        "\tV      interface{} `codec:\"v\"` // one of int, string\n" +
+        "}\n\n" +
+        "type ReadingPos struct {\n" +
+        "\tX int16 `codec:\"x\"`\n" +
+        "}\n"
+    if string(source) != expected {
+        t.Fatalf("Generated source:\n%s", source)
+    }
+}
+
+func TestGoName(t *testing.T) {
+    for key, name := range map[string]string{
+        "user_id": "UserID", "firstName": "FirstName", "http-url": "HTTPURL", "2fa": "F2fa", "": "F",
+    } {
+        if goName(key) != name {
+            t.Fatalf("Key %s was converted to %s", key, goName(key))
+        }
+    }
+
+    if !strings.HasPrefix(goIntType(&inferredType{ints: 1, maxUint: 1 << 63}), "uint64") {
+        t.Fatal("Integer above int64 range doesn't have uint64 type")
+    }
+}
+
+func TestGenerateGoTypesFromSampleFile(t *testing.T) {
+    // {"b": bin, "s": "hi", "t": timestamp, "e": ext 5, "n": -1}, {"n": 2^64-1, ...}
+    sample := "\x85\xa1b\xc4\x02\x01\x02\xa1s\xa2hi\xa1t\xd6\xff\x00\x00\x00\x01\xa1e\xd4\x05\x00\xa1n\xff" +
+        "\x85\xa1b\xc4\x00\xa1s\xa0\xa1t\xd6\xff\x00\x00\x00\x02\xa1e\xd4\x05\x01\xa1n\xcf\xff\xff\xff\xff\xff\xff\xff\xff"
+    filename := filepath.Join(tempDir(t), "sample.bin")
+    if err := ioutil.WriteFile(filename, []byte(sample), 0666); err != nil {
+        t.Fatal(err)
+    }
+
+    root, err := inferSamples([]string{filename})
+    if err != nil {
+        t.Fatal(err)
+    }
+    source, err := generateGoTypes(root, "Sample", "main")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := "package main\n\n" +
+        "import (\n\t\"github.com/ugorji/go/codec\"\n\t\"time\"\n)\n\n" +
+        "type Sample struct {\n" +
+        "\tB []byte       `codec:\"b\"`\n" +
+        "\tE codec.RawExt `codec:\"e\"`\n" +
+        "\tN interface{}  `codec:\"n\"` // one of int64, uint64\n" +
+        "\tS string       `codec:\"s\"`\n" +
+        "\tT time.Time    `codec:\"t\"`\n" +
+        "}\n"
+    if string(source) != expected {
+        t.Fatalf("Generated source:\n%s", source)
+    }
+}
@@ -3,6 +3,10 @@ module github.com/jakm/msgpack-cli
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/docopt/docopt-go v0.0.0-20180111231733-ee0de3bc6815
+	github.com/golang/snappy v0.0.4
+	github.com/klauspost/compress v1.11.13
+	github.com/pierrec/lz4/v4 v4.1.22
 	github.com/ugorji/go/codec v1.1.7
 )
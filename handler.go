@@ -0,0 +1,127 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "fmt"
+    "github.com/jakm/msgpack-cli/convert"
+    "os"
+    "sync"
+)
+
+type handlerReply struct {
+    result interface{}
+    err    interface{}
+}
+
+type incomingFrame struct {
+    Type   string      `json:"type"`
+    Msgid  *uint32     `json:"msgid,omitempty"`
+    Method string      `json:"method"`
+    Params interface{} `json:"params"`
+}
+
+// printingRPCHandler writes requests and notifications sent by server to
+// STDOUT as JSON lines. Requests are answered from handlers file, or with
+// configured error. Channel until is closed when notification untilMethod
+// is received, channel received is signalled on every frame.
+type printingRPCHandler struct {
+    handlers     map[string]handlerReply
+    requestError interface{}
+    untilMethod  string
+    until        chan struct{}
+    untilOnce    sync.Once
+    received     chan struct{}
+}
+
+func (h *printingRPCHandler) HandleRequest(msgid uint32, method string, params interface{}) (result, err interface{}) {
+    printIncomingFrame(incomingFrame{Type: "request", Msgid: &msgid, Method: method, Params: params})
+    h.signalReceived()
+
+    if reply, ok := h.handlers[method]; ok {
+        return reply.result, reply.err
+    }
+    return nil, h.requestError
+}
+
+func (h *printingRPCHandler) HandleNotification(method string, params interface{}) {
+    printIncomingFrame(incomingFrame{Type: "notification", Method: method, Params: params})
+    h.signalReceived()
+
+    if method == h.untilMethod {
+        h.untilOnce.Do(func() { close(h.until) })
+    }
+}
+
+func (h *printingRPCHandler) signalReceived() {
+    select {
+    case h.received <- struct{}{}:
+    default:
+    }
+}
+
+func printIncomingFrame(frame incomingFrame) {
+    if data, err := encodeRPCReply(frame, false); err == nil {
+        fmt.Print(data)
+    }
+}
+
+func newPrintingRPCHandler(options Options) (*printingRPCHandler, error) {
+    h := &printingRPCHandler{
+        handlers:     make(map[string]handlerReply),
+        requestError: options.requestError,
+        untilMethod:  options.until,
+        until:        make(chan struct{}),
+        received:     make(chan struct{}, 1),
+    }
+
+    if options.handlersFile != "" {
+        if err := h.loadHandlers(options.handlersFile, options.convertToInt64); err != nil {
+            return nil, err
+        }
+    }
+
+    return h, nil
+}
+
+// loadHandlers reads JSON object that maps method names to replies, which are
+// objects with either "result" or "error" key.
+func (h *printingRPCHandler) loadHandlers(filename string, convertToInt64 bool) error {
+    file, err := os.Open(filename)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    var object interface{}
+    if err = convert.NewJSONDecoder(file, convertToInt64).Decode(&object); err != nil {
+        return decodeError(fmt.Errorf("Handlers file: %s", err))
+    }
+
+    methods, ok := object.(map[string]interface{})
+    if !ok {
+        return decodeError(fmt.Errorf("Handlers file: JSON object expected"))
+    }
+
+    for method, value := range methods {
+        reply, ok := value.(map[string]interface{})
+        if !ok {
+            return decodeError(fmt.Errorf("Handlers file: reply of method %s is not an object", method))
+        }
+        h.handlers[method] = handlerReply{result: reply["result"], err: reply["error"]}
+    }
+
+    return nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/ugorji/go/codec"
+    "math"
+    "os"
+    "sort"
+    "time"
+)
+
+// inferredType merges types of values observed at the same place of samples.
+// Counters tell how many values of each kind were seen.
+type inferredType struct {
+    count    int
+    nulls    int
+    bools    int
+    ints     int
+    floats   int
+    strings  int
+    binaries int
+    times    int
+    exts     int
+    arrays   int
+    maps     int
+    // ranges of integers up to math.MaxInt64 (signedInts of them) and of
+    // integers above it, ints counts both
+    signedInts int
+    minInt     int64
+    maxInt     int64
+    minUint    uint64
+    maxUint    uint64
+    // range of floats
+    minFloat float64
+    maxFloat float64
+    // distinct strings with their counts, nil when there are more than
+    // maxStringValues of them
+    stringValues map[string]int
+    // tags of extensions
+    extTags map[uint64]bool
+    // elements of arrays and fields of maps, with number of maps having them
+    elem        *inferredType
+    fields      map[string]*inferredType
+    fieldCounts map[string]int
+}
+
+// maxStringValues is the highest number of distinct strings remembered at one
+// place of samples.
+const maxStringValues = 16
+
+func newInferredType() *inferredType {
+    return &inferredType{
+        fields:       make(map[string]*inferredType),
+        fieldCounts:  make(map[string]int),
+        stringValues: make(map[string]int),
+        extTags:      make(map[uint64]bool),
+    }
+}
+
+// Encode observes value, so that samples can be read by convert.Convert.
+func (t *inferredType) Encode(value interface{}) error {
+    t.observe(value)
+    return nil
+}
+
+// observe merges type of value.
+func (t *inferredType) observe(value interface{}) {
+    t.count++
+
+    switch value := value.(type) {
+    case nil:
+        t.nulls++
+    case bool:
+        t.bools++
+    case int64:
+        t.observeInt(value)
+    case uint64:
+        if value > math.MaxInt64 {
+            if t.maxUint == 0 || value < t.minUint {
+                t.minUint = value
+            }
+            if value > t.maxUint {
+                t.maxUint = value
+            }
+            t.ints++
+        } else {
+            t.observeInt(int64(value))
+        }
+    case float32:
+        t.observeFloat(float64(value))
+    case float64:
+        t.observeFloat(value)
+    case string:
+        t.strings++
+        if t.stringValues != nil {
+            t.stringValues[value]++
+            if len(t.stringValues) > maxStringValues {
+                t.stringValues = nil
+            }
+        }
+    case []byte:
+        t.binaries++
+    case time.Time:
+        t.times++
+    case codec.RawExt:
+        t.exts++
+        t.extTags[value.Tag] = true
+    case []interface{}:
+        t.arrays++
+        if t.elem == nil {
+            t.elem = newInferredType()
+        }
+        for _, elem := range value {
+            t.elem.observe(elem)
+        }
+    case map[string]interface{}:
+        t.maps++
+        for key, elem := range value {
+            field, ok := t.fields[key]
+            if !ok {
+                field = newInferredType()
+                t.fields[key] = field
+            }
+            field.observe(elem)
+            t.fieldCounts[key]++
+        }
+    }
+}
+
+func (t *inferredType) observeInt(value int64) {
+    if t.signedInts == 0 || value < t.minInt {
+        t.minInt = value
+    }
+    if t.signedInts == 0 || value > t.maxInt {
+        t.maxInt = value
+    }
+    t.signedInts++
+    t.ints++
+}
+
+func (t *inferredType) observeFloat(value float64) {
+    if t.floats == 0 || value < t.minFloat {
+        t.minFloat = value
+    }
+    if t.floats == 0 || value > t.maxFloat {
+        t.maxFloat = value
+    }
+    t.floats++
+}
+
+// kinds returns number of different kinds of non-null values.
+func (t *inferredType) kinds() int {
+    kinds := 0
+    for _, n := range []int{t.bools, t.ints, t.floats, t.strings, t.binaries, t.times, t.exts, t.arrays, t.maps} {
+        if n > 0 {
+            kinds++
+        }
+    }
+    return kinds
+}
+
+// kindNames returns names of observed kinds of non-null values.
+func (t *inferredType) kindNames() []string {
+    var names []string
+    for _, kind := range []struct {
+        name  string
+        count int
+    }{
+        {"bool", t.bools}, {"int", t.ints}, {"float", t.floats}, {"string", t.strings},
+        {"bin", t.binaries}, {"timestamp", t.times}, {"ext", t.exts}, {"array", t.arrays},
+        {"map", t.maps},
+    } {
+        if kind.count > 0 {
+            names = append(names, kind.name)
+        }
+    }
+    return names
+}
+
+// numeric returns true if only integers and floats were observed.
+func (t *inferredType) numeric() bool {
+    return t.ints+t.floats+t.nulls == t.count && t.ints+t.floats > 0
+}
+
+// fieldNames returns sorted names of fields.
+func (t *inferredType) fieldNames() []string {
+    names := make([]string, 0, len(t.fields))
+    for name := range t.fields {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// required returns true if field is present in every observed map.
+func (t *inferredType) required(key string) bool {
+    return t.fieldCounts[key] == t.maps
+}
+
+// inferSamples returns type merged from all msgpack objects in sample files.
+func inferSamples(filenames []string) (*inferredType, error) {
+    root := newInferredType()
+
+    for _, filename := range filenames {
+        if err := inferSampleFile(root, filename); err != nil {
+            return nil, err
+        }
+    }
+    return root, nil
+}
+
+func inferSampleFile(root *inferredType, filename string) error {
+    file := os.Stdin
+    if filename != "-" {
+        var err error
+        if file, err = os.Open(filename); err != nil {
+            return err
+        }
+        defer file.Close()
+    }
+
+    reader, err := convert.NewDecompressingReader(file)
+    if err != nil {
+        return decodeError(err)
+    }
+    defer reader.Close()
+
+    return convert.Convert(convert.NewMsgpackBinDecoder(reader), root)
+}
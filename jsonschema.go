@@ -0,0 +1,188 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "sort"
+)
+
+// jsonSchemaDraft is the version of JSON Schema written by InferSchema.
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// InferSchema infers type of msgpack objects in sample files (- for STDIN)
+// and writes it to STDOUT as JSON Schema. Keys present in every map are
+// required, strings with few distinct values are enums and numbers have
+// observed ranges. Values without JSON type are annotated by x-msgpack-type.
+func InferSchema(filenames []string) error {
+    root, err := inferSamples(filenames)
+    if err != nil {
+        return err
+    }
+    if root.count == 0 {
+        return decodeError(fmt.Errorf("No samples found"))
+    }
+
+    schema := jsonSchema(root)
+    schema["$schema"] = jsonSchemaDraft
+
+    data, err := json.MarshalIndent(schema, "", "  ")
+    if err != nil {
+        return err
+    }
+    _, err = fmt.Fprintf(os.Stdout, "%s\n", data)
+    return err
+}
+
+// jsonSchema returns JSON Schema of t. Different kinds of values are merged
+// by anyOf.
+func jsonSchema(t *inferredType) map[string]interface{} {
+    var schemas []map[string]interface{}
+
+    if t.nulls > 0 {
+        schemas = append(schemas, map[string]interface{}{"type": "null"})
+    }
+    if t.bools > 0 {
+        schemas = append(schemas, map[string]interface{}{"type": "boolean"})
+    }
+    if t.ints+t.floats > 0 {
+        schemas = append(schemas, numberSchema(t))
+    }
+    if t.strings > 0 {
+        schemas = append(schemas, stringSchema(t))
+    }
+    if t.binaries > 0 {
+        schemas = append(schemas, map[string]interface{}{
+            "type":            "string",
+            "contentEncoding": "base64",
+            "x-msgpack-type":  "bin",
+        })
+    }
+    if t.times > 0 {
+        schemas = append(schemas, map[string]interface{}{
+            "type":           "string",
+            "format":         "date-time",
+            "x-msgpack-type": "timestamp",
+        })
+    }
+    if t.exts > 0 {
+        schemas = append(schemas, extSchema(t))
+    }
+    if t.arrays > 0 {
+        items := map[string]interface{}{}
+        if t.elem.count > 0 {
+            items = jsonSchema(t.elem)
+        }
+        schemas = append(schemas, map[string]interface{}{"type": "array", "items": items})
+    }
+    if t.maps > 0 {
+        schemas = append(schemas, objectSchema(t))
+    }
+
+    switch len(schemas) {
+    case 0:
+        return map[string]interface{}{}
+    case 1:
+        return schemas[0]
+    default:
+        return map[string]interface{}{"anyOf": schemas}
+    }
+}
+
+func numberSchema(t *inferredType) map[string]interface{} {
+    schema := map[string]interface{}{"type": "integer"}
+
+    var (
+        minimum, maximum interface{}
+        minInt, maxInt   float64
+    )
+    if t.ints > 0 {
+        // integers above math.MaxInt64 are the only ones if none are signed
+        if t.signedInts > 0 {
+            minimum, minInt = t.minInt, float64(t.minInt)
+        } else {
+            minimum, minInt = t.minUint, float64(t.minUint)
+        }
+        if t.maxUint > 0 {
+            maximum, maxInt = t.maxUint, float64(t.maxUint)
+        } else {
+            maximum, maxInt = t.maxInt, float64(t.maxInt)
+        }
+    }
+    if t.floats > 0 {
+        schema["type"] = "number"
+        if t.ints == 0 || t.minFloat < minInt {
+            minimum = t.minFloat
+        }
+        if t.ints == 0 || t.maxFloat > maxInt {
+            maximum = t.maxFloat
+        }
+    }
+    schema["minimum"], schema["maximum"] = minimum, maximum
+
+    return schema
+}
+
+// stringSchema returns schema of strings, they are enum if some of their
+// values repeat and there are at most maxStringValues of them.
+func stringSchema(t *inferredType) map[string]interface{} {
+    schema := map[string]interface{}{"type": "string"}
+
+    if t.stringValues != nil && len(t.stringValues) < t.strings {
+        values := make([]string, 0, len(t.stringValues))
+        for value := range t.stringValues {
+            values = append(values, value)
+        }
+        sort.Strings(values)
+        schema["enum"] = values
+    }
+
+    return schema
+}
+
+// extSchema returns schema of extensions, they are written to JSON as objects
+// with Tag and Data.
+func extSchema(t *inferredType) map[string]interface{} {
+    tags := make([]uint64, 0, len(t.extTags))
+    for tag := range t.extTags {
+        tags = append(tags, tag)
+    }
+    sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+    return map[string]interface{}{
+        "type":               "object",
+        "x-msgpack-type":     "ext",
+        "x-msgpack-ext-tags": tags,
+    }
+}
+
+func objectSchema(t *inferredType) map[string]interface{} {
+    properties := make(map[string]interface{}, len(t.fields))
+    required := []string{}
+    for _, name := range t.fieldNames() {
+        properties[name] = jsonSchema(t.fields[name])
+        if t.required(name) {
+            required = append(required, name)
+        }
+    }
+
+    schema := map[string]interface{}{"type": "object", "properties": properties}
+    if len(required) > 0 {
+        schema["required"] = required
+    }
+    return schema
+}
@@ -0,0 +1,78 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "encoding/json"
+    "github.com/ugorji/go/codec"
+    "io/ioutil"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestJSONSchema(t *testing.T) {
+    root := newInferredType()
+    for _, sample := range []map[string]interface{}{
+        {"level": "info", "n": int64(-2), "data": []byte{1}, "at": time.Unix(0, 0)},
+        {"level": "info", "n": 2.5, "ext": codec.RawExt{Tag: 5}},
+        {"level": "warn", "n": uint64(7), "data": "text"},
+    } {
+        root.observe(sample)
+    }
+
+    data, err := json.Marshal(jsonSchema(root))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := `{"properties":{` +
+        `"at":{"format":"date-time","type":"string","x-msgpack-type":"timestamp"},` +
+        `"data":{"anyOf":[{"type":"string"},{"contentEncoding":"base64","type":"string","x-msgpack-type":"bin"}]},` +
+        `"ext":{"type":"object","x-msgpack-ext-tags":[5],"x-msgpack-type":"ext"},` +
+        `"level":{"enum":["info","warn"],"type":"string"},` +
+        `"n":{"maximum":7,"minimum":-2,"type":"number"}},` +
+        `"required":["level","n"],"type":"object"}`
+    if string(data) != expected {
+        t.Fatalf("Inferred schema is %s", data)
+    }
+}
+
+func TestJSONSchemaOfSampleFile(t *testing.T) {
+    // {"b": bin, "n": 2^63+1}, {"b": bin, "n": 5}
+    sample := "\x82\xa1b\xc4\x02\x01\x02\xa1n\xcf\x80\x00\x00\x00\x00\x00\x00\x01" +
+        "\x82\xa1b\xc4\x00\xa1n\x05"
+    filename := filepath.Join(tempDir(t), "sample.bin")
+    if err := ioutil.WriteFile(filename, []byte(sample), 0666); err != nil {
+        t.Fatal(err)
+    }
+
+    root := newInferredType()
+    if err := inferSampleFile(root, filename); err != nil {
+        t.Fatal(err)
+    }
+    data, err := json.Marshal(jsonSchema(root))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := `{"properties":{` +
+        `"b":{"contentEncoding":"base64","type":"string","x-msgpack-type":"bin"},` +
+        `"n":{"maximum":9223372036854775809,"minimum":5,"type":"integer"}},` +
+        `"required":["b","n"],"type":"object"}`
+    if string(data) != expected {
+        t.Fatalf("Inferred schema is %s", data)
+    }
+}
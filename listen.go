@@ -0,0 +1,80 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "net"
+    "time"
+)
+
+// Listen writes notifications sent by server to STDOUT as JSON lines until
+// ctx is done, the connection is closed or no frame is received for
+// options.idleTimeout. If method is given, it's called first to subscribe for
+// notifications.
+func Listen(ctx context.Context, host, port, method, params string, options Options) (err error) {
+    var (
+        args    interface{}
+        conn    net.Conn
+        printer *printingRPCHandler
+    )
+
+    if method != "" {
+        if args, err = getCallArgs(params, options); err != nil {
+            return err
+        }
+    }
+
+    if printer, err = newPrintingRPCHandler(options); err != nil {
+        return err
+    }
+
+    if conn, err = dialRPC(ctx, host, port, options); err != nil {
+        return err
+    }
+    client := rpcclient.NewClient(conn, printer, nil)
+    defer client.Close()
+
+    if method != "" {
+        callCtx, cancel := withTimeout(ctx, options.timeout)
+        stop := closeIfCancelled(callCtx, client)
+        call := client.Go(method, args, nil)
+        stop()
+        _, err = waitRPCReply(callCtx, call, options)
+        cancel()
+        if err != nil {
+            return err
+        }
+    }
+
+    var idle <-chan time.Time
+
+    for {
+        if options.idleTimeout > 0 {
+            idle = time.After(options.idleTimeout)
+        }
+
+        select {
+        case <-printer.received:
+        case <-idle:
+            return nil
+        case <-ctx.Done():
+            return contextError(ctx)
+        case <-client.Done():
+            return client.Err()
+        }
+    }
+}
@@ -0,0 +1,117 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "io/ioutil"
+    "net"
+    "path/filepath"
+    "reflect"
+    "sort"
+    "testing"
+    "time"
+)
+
+func TestPrintingHandlerAnswersServer(t *testing.T) {
+    handlersFile := filepath.Join(tempDir(t), "handlers.json")
+    if err := ioutil.WriteFile(handlersFile, []byte(`{"ping": {"result": "pong"}}`), 0644); err != nil {
+        t.Fatal(err)
+    }
+    handler, err := newPrintingRPCHandler(Options{handlersFile: handlersFile, requestError: "unsupported"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    clientConn, serverConn := net.Pipe()
+    defer serverConn.Close()
+
+    var responses [][]interface{}
+    output := captureStdout(t, func() {
+        client := rpcclient.NewClient(clientConn, handler, nil)
+        defer client.Close()
+
+        encoder := convert.NewMsgpackEncoder(serverConn)
+        decoder := convert.NewMsgpackDecoder(serverConn)
+        encoder.Encode([]interface{}{rpcclient.Notification, "tick", []interface{}{int64(1)}})
+        encoder.Encode([]interface{}{rpcclient.Request, 7, "ping", []interface{}{}})
+        encoder.Encode([]interface{}{rpcclient.Request, 8, "other", []interface{}{}})
+
+        for len(responses) < 2 {
+            var frame []interface{}
+            if err := decoder.Decode(&frame); err != nil {
+                t.Errorf("Reading of response failed: %s", err)
+                return
+            }
+            responses = append(responses, frame)
+        }
+    })
+
+    // responses are sent asynchronously
+    sort.Slice(responses, func(i, j int) bool {
+        return responses[i][1].(int64) < responses[j][1].(int64)
+    })
+    expected := [][]interface{}{
+        {int64(rpcclient.Response), int64(7), nil, "pong"},
+        {int64(rpcclient.Response), int64(8), "unsupported", nil},
+    }
+    if !reflect.DeepEqual(responses, expected) {
+        t.Fatalf("Handler replied %#v, expected %#v", responses, expected)
+    }
+
+    expectedOutput := `{"type":"notification","method":"tick","params":[1]}` + "\n" +
+        `{"type":"request","msgid":7,"method":"ping","params":[]}` + "\n" +
+        `{"type":"request","msgid":8,"method":"other","params":[]}` + "\n"
+    if output != expectedOutput {
+        t.Fatalf("Handler printed:\n%s\nexpected:\n%s", output, expectedOutput)
+    }
+}
+
+func TestListenUntilInterrupted(t *testing.T) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer listener.Close()
+    host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    go func() {
+        conn, err := listener.Accept()
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        convert.NewMsgpackEncoder(conn).Encode([]interface{}{rpcclient.Notification, "tick", []interface{}{}})
+        time.Sleep(20 * time.Millisecond)
+        cancel()
+        <-time.After(time.Second)
+    }()
+
+    output := captureStdout(t, func() {
+        err = Listen(ctx, host, port, "", "", Options{})
+    })
+
+    if exitCode(err) != exitInterrupted {
+        t.Fatalf("Listen returned %v, expected interruption", err)
+    }
+    if expected := `{"type":"notification","method":"tick","params":[]}` + "\n"; output != expected {
+        t.Fatalf("Listen printed %q, expected %q", output, expected)
+    }
+}
@@ -15,35 +15,259 @@
 package main
 
 import (
+    "context"
+    "errors"
     "fmt"
     "github.com/docopt/docopt-go"
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/jakm/msgpack-cli/rpcclient"
     "io/ioutil"
     "log"
+    "net"
+    "os"
+    "os/signal"
     "strconv"
+    "strings"
+    "time"
 )
 
 const usage = `msgpack-cli
 
 Usage:
-    msgpack-cli encode [<input-file>] [--out=<output-file>] [--disable-int64-conv]
-    msgpack-cli decode [<input-file>] [--out=<output-file>] [--pp]
-    msgpack-cli rpc <host> <port> <method> [<params>|--file=<input-file>] [--pp]
-        [--timeout=<timeout>][--disable-int64-conv]
+    msgpack-cli encode [<input-file>] [--out=<output-file>] [--from=<format>]
+        [--in-encoding=<encoding>] [--out-encoding=<encoding>]
+        [--schema=<schema-file>] [--compress=<compression>]
+        [--disable-int64-conv]
+    msgpack-cli decode [<input-file>] [--out=<output-file>] [--to=<format>]
+        [--in-encoding=<encoding>] [--out-encoding=<encoding>]
+        [--schema=<schema-file>] [--compress=<compression>] [--pp]
+    msgpack-cli convert [<input-file>] --from=<format> --to=<format>
+        [--out=<output-file>] [--in-encoding=<encoding>]
+        [--out-encoding=<encoding>] [--schema=<schema-file>]
+        [--compress=<compression>] [--disable-int64-conv] [--pp]
+    msgpack-cli formats
+    msgpack-cli gen-types <sample-file>... [--name=<type>]
+        [--package=<package>]
+    msgpack-cli infer-schema <sample-file>...
+    msgpack-cli edit <input-file> [--out=<output-file>] [--set=<path-value>...]
+        [--append=<path-value>...] [--delete=<path>...]
+    msgpack-cli rpc <host> <port> <method>
+        [<params>|--file=<input-file>|--arg=<arg>...] [--map-params]
+        [--params-format=<format>] [--pp|--raw-reply]
+        [--notifications [--handlers=<handlers-file>] [--request-error=<error>]
+        [--until=<notification>]] [--timeout=<timeout>] [--disable-int64-conv]
+        [--error-stdout] [--record=<session-file> [--compress=<compression>]]
+        [--retries=<n>] [--backoff=<delay>] [--connect-timeout=<timeout>]
+        [--fallback=<endpoint>...] [--read-timeout=<timeout>]
+        [--write-timeout=<timeout>] [--watch=<interval> [--changes] [--diff]
+        [--count=<n>] [--watch-until=<condition>]]
+    msgpack-cli rpc <host> <port> --batch=<calls-file> [--inflight=<n>]
+        [--order=<order>] [--timeout=<timeout>] [--disable-int64-conv]
+        [--retries=<n>] [--backoff=<delay>] [--connect-timeout=<timeout>]
+        [--fallback=<endpoint>...] [--read-timeout=<timeout>]
+        [--write-timeout=<timeout>]
+    msgpack-cli fanout <hosts> <method>
+        [<params>|--file=<input-file>|--arg=<arg>...] [--map-params]
+        [--inflight=<n>] [--timeout=<timeout>] [--disable-int64-conv]
+        [--retries=<n>] [--backoff=<delay>] [--connect-timeout=<timeout>]
+        [--read-timeout=<timeout>] [--write-timeout=<timeout>]
+    msgpack-cli listen <host> <port>
+        [<method> [<params>|--file=<input-file>|--arg=<arg>...] [--map-params]]
+        [--idle-timeout=<timeout>] [--handlers=<handlers-file>]
+        [--request-error=<error>] [--timeout=<timeout>] [--disable-int64-conv]
+        [--error-stdout] [--retries=<n>] [--backoff=<delay>]
+        [--connect-timeout=<timeout>] [--fallback=<endpoint>...]
+        [--write-timeout=<timeout>]
+    msgpack-cli describe <host> <port> [--discovery=<method>] [--names|--json]
+        [--pp] [--cache=<cache-file>] [--cache-ttl=<ttl>] [--timeout=<timeout>]
+        [--disable-int64-conv] [--retries=<n>] [--backoff=<delay>]
+        [--connect-timeout=<timeout>] [--fallback=<endpoint>...]
+    msgpack-cli bench <host> <port> <method>
+        [<params>|--file=<input-file>|--arg=<arg>...] [--map-params]
+        [--concurrency=<n>] [--requests=<n>|--duration=<duration>]
+        [--connections=<n>] [--rate=<rate>] [--pp] [--timeout=<timeout>]
+        [--disable-int64-conv]
+    msgpack-cli replay <session-file> <host> <port> [--timeout=<timeout>]
+    msgpack-cli replay <session-file> --serve=<address>
+    msgpack-cli proxy <address> <host> <port> [--delay=<method-delay>...]
+        [--fail=<method-error>...]
+    msgpack-cli gateway <address> <host> <port> [--pp] [--timeout=<timeout>]
+        [--disable-int64-conv]
     msgpack-cli -h | --help
     msgpack-cli --version
 
 Commands:
     encode                Encode data from input file (default STDIN) to STDOUT
     decode                Decode data from input file (default STDIN) to STDOUT
+    convert               Convert data from input file (default STDIN) between
+                          formats and write them to STDOUT, encode converts
+                          to msgpack (from json by default) and decode from
+                          msgpack (to json by default)
+    formats               List formats available for conversion with their
+                          capabilities
+    gen-types             Infer type of msgpack objects in sample files and
+                          write its Go definition with codec tags to STDOUT
+    infer-schema          Infer type of msgpack objects in sample files and
+                          write it to STDOUT as JSON Schema, with required
+                          keys, enums of repeated strings, ranges of numbers
+                          and x-msgpack-type of bin, ext and timestamp values
+    edit                  Change values at paths of every msgpack object in
+                          input file (- for STDIN) and write it back, or to
+                          output file; bytes of other values are kept as
+                          they are, sets are applied first, then appends
+                          and deletions
     rpc                   Call RPC method and write result to STDOUT
+    fanout                Call RPC method on every host and write results
+                          with latency (in milliseconds) to STDOUT as JSON
+                          lines
+    listen                Write notifications sent by RPC server to STDOUT as
+                          JSON lines until interrupted, optionally call
+                          subscription method first
+    describe              Call discovery method of RPC server and write its
+                          methods with names and types of params to STDOUT
+    bench                 Call RPC method repeatedly and write report with
+                          throughput, latency percentiles (in milliseconds)
+                          and errors to STDOUT
+    replay                Call RPC methods recorded in session file again and
+                          compare replies with recorded ones, or serve
+                          recorded replies as fake RPC server
+    proxy                 Listen on address and forward connections to RPC
+                          server, write every frame to STDOUT as JSON line
+    gateway               Listen on address for HTTP requests
+                          POST /rpc/<method> with JSON params in body and
+                          return result of RPC call as JSON
 
 Options:
     -h --help             Show this help message and exit
     --version             Show version
     --out=<output-file>   Write output data to file instead of STDOUT
+    --from=<format>       Format of input data: json, msgpack, toml, csv or
+                          tsv
+    --to=<format>         Format of output data; maps, or arrays of maps, are
+                          written to csv and tsv as rows with nested values
+                          in columns with dotted paths
+    --in-encoding=<encoding>
+                          Encoding of input bytes: raw, hex, base64,
+                          base64url or c-array (initializer list like
+                          {0x82, 0xa1}) [default: raw]
+    --out-encoding=<encoding>
+                          Encoding of output bytes, same as --in-encoding
+                          [default: raw]
+    --compress=<compression>
+                          Compress output data, or recorded session, by
+                          gzip, zstd, lz4 or snappy; compressed input data,
+                          params file and session file are detected and
+                          decompressed
+    --set=<path-value>    Set value at path, given as <path>=<value>, e.g.
+                          .config.retries=5; value is JSON, other text is
+                          a string, and missing keys of maps are added
+    --append=<path-value> Append value to array at path, given as
+                          <path>=<value>
+    --delete=<path>       Delete key of map or element of array at path
+    --name=<type>         Name of generated type [default: Sample]
+    --package=<package>   Package of generated types [default: main]
+    --schema=<schema-file>
+                          JSON file describing positional arrays in msgpack
+                          data, e.g. ["id", {"name": "pos", "fields": ["x",
+                          "y"]}, {"name": "tags", "items": ["k", "v"]}];
+                          decoded arrays are written as objects with named
+                          fields, objects are encoded back to arrays
     --file=<input-file>   File where parameters or RPC method are read from
+    --arg=<arg>           Parameter of RPC method, type is given by prefix:
+                          s:<text> string, i:<number> integer, f:<number>
+                          float, b:<bool> boolean, json:<json> JSON value,
+                          @<file> content of file as string, bin:@<file>
+                          content of file as binary, bin:<text> text as
+                          binary; parameter without prefix is a string
+    --map-params          Pass parameters given by --arg as single map, each
+                          of them given as <name>=<arg>
+    --params-format=<format>
+                          Format of params, "json" or "msgpack"; params in
+                          msgpack format are read from file or STDIN and
+                          can't be combined with --arg [default: json]
     --pp                  Pretty-print - indent output JSON data
-    --timeout=<timeout>   Timeout of RPC call [default: 30]
+    --raw-reply           Write reply to STDOUT as msgpack bytes sent by server
+    --timeout=<timeout>   Timeout of RPC call, either number of seconds or
+                          duration like 250ms or 1m30s, 0 means no timeout
+                          [default: 30s]
+    --retries=<n>         Number of additional attempts to connect to server
+                          [default: 0]
+    --backoff=<delay>     Delay before the first repeated attempt to connect,
+                          doubled with every attempt, random jitter is
+                          added [default: 200ms]
+    --connect-timeout=<timeout>
+                          Timeout of single attempt to connect, 0 means
+                          system default [default: 0]
+    --read-timeout=<timeout>
+                          Fail when nothing is read from server for this
+                          long, 0 means no timeout [default: 0]
+    --write-timeout=<timeout>
+                          Fail when writing to server blocks for this long,
+                          0 means no timeout [default: 0]
+    --fallback=<endpoint> Endpoint <host>:<port> to connect to if the server
+                          and previous fallbacks are unreachable
+    --error-stdout        Write error object returned by RPC server to STDOUT
+                          instead of STDERR
+    --notifications       Write requests and notifications sent by RPC server
+                          during the call to STDOUT as JSON lines
+    --handlers=<handlers-file>
+                          JSON object mapping names of methods requested by
+                          server to replies {"result": ...} or {"error": ...}
+    --request-error=<error>
+                          Error returned to server for requests not found in
+                          handlers file [default: Method not found]
+    --until=<notification>
+                          Keep the connection open after the reply until
+                          notification of this name is received or RPC call
+                          times out
+    --idle-timeout=<timeout>
+                          Stop listening when nothing is received for this
+                          long, 0 means never [default: 0]
+    --discovery=<method>  Method returning description of RPC methods, e.g.
+                          nvim_get_api_info [default: system.listMethods]
+    --names               Write only names of methods, e.g. for completion
+    --json                Write description of methods as JSON
+    --cache=<cache-file>  Read description of methods from file, or write it
+                          there if it's missing, expired or written for
+                          other server or discovery method
+    --cache-ttl=<ttl>     Expiration of cached description [default: 1h]
+    --concurrency=<n>     Number of concurrent bench workers [default: 1]
+    --requests=<n>        Total number of bench calls [default: 1000]
+    --duration=<duration> Run bench for this long instead of fixed number
+                          of calls
+    --connections=<n>     Number of connections shared by bench workers
+                          [default: 1]
+    --rate=<rate>         Limit bench to this number of calls per second, at
+                          most 1000000, 0 means unlimited [default: 0]
+    --record=<session-file>
+                          Record all frames of RPC session with timestamps
+                          to file
+    --serve=<address>     Listen on address (e.g. localhost:8000) and answer
+                          requests with replies from session file
+    --delay=<method-delay>
+                          Forward requests of method with delay given as
+                          <method>=<duration>, e.g. echo=500ms
+    --fail=<method-error> Answer requests of method with error instead of
+                          forwarding, given as <method>=<error>
+    --watch=<interval>    Call RPC method repeatedly with this interval over
+                          single connection and write every reply
+    --changes             Write only replies that differ from the previous one
+    --diff                Write changes of reply as JSON array of objects
+                          {"op": ..., "path": ..., "old": ..., "new": ...}
+                          instead of whole reply, implies --changes
+    --count=<n>           Stop watching after this number of calls, 0 means
+                          never [default: 0]
+    --watch-until=<condition>
+                          Stop watching when value at JSON path of reply is
+                          equal to JSON value, given as <path>=<value>, e.g.
+                          $.status="ready"
+    --batch=<calls-file>  Pipeline RPC calls read from file (- for STDIN), one
+                          JSON object {"method": ..., "params": ...} per line,
+                          and write results to STDOUT as JSON lines
+    --inflight=<n>        Maximum number of batch calls in flight, or hosts
+                          called at once by fanout [default: 16]
+    --order=<order>       Order of batch results, "request" or "completion"
+                          [default: request]
     --disable-int64-conv  Disable the default behaviour such that JSON numbers
                           are converted to float64 or int64 numbers by their
                           meaning, all result numbers will have float64 type
@@ -51,25 +275,90 @@ Options:
 
 Arguments:
     <input-file>          File where data are read from
+    <sample-file>         File with msgpack objects, - for STDIN
+    <address>             Local address to listen on, e.g. localhost:8080
     <host>                Server hostname
+    <hosts>               Servers <host>:<port> separated by commas, or file
+                          with one server per line given as @<file> (@- for
+                          STDIN); {a,b} alternatives and [1-12] ranges are
+                          expanded, e.g. app-[01-12].local:8000, to at most
+                          10000 servers
     <port>                Server port
     <method>              Name of RPC method
-    <params>              Parameters of RPC method in JSON format`
+    <params>              Parameters of RPC method in JSON format
+
+Exit status:
+    0                     Success
+    1                     Other failure
+    2                     Invalid usage
+    3                     Connection failure
+    4                     RPC call timed out
+    5                     RPC server returned an error
+    6                     Data or reply decoding failure
+    130                   Interrupted`
 
 type Options struct {
-    convertToInt64 bool
-    indent         bool
-    timeout        uint32
+    convertToInt64    bool
+    indent            bool
+    inEncoding        string
+    outEncoding       string
+    schemaFile        string
+    compression       string
+    typeName          string
+    packageName       string
+    timeout           time.Duration
+    errorToStdout     bool
+    record            string
+    retries           int
+    backoff           time.Duration
+    connectTimeout    time.Duration
+    readTimeout       time.Duration
+    writeTimeout      time.Duration
+    fallbacks         []string
+    delays            map[string]time.Duration
+    failures          map[string]string
+    idleTimeout       time.Duration
+    notifications     bool
+    handlersFile      string
+    requestError      string
+    until             string
+    args              []string
+    mapParams         bool
+    msgpackParams     bool
+    rawReply          bool
+    watch             time.Duration
+    changesOnly       bool
+    diff              bool
+    count             int
+    untilPath         []interface{}
+    untilValue        interface{}
+    discovery         string
+    methodNames       bool
+    jsonOutput        bool
+    cacheFile         string
+    cacheTTL          time.Duration
+    inflight          int
+    concurrency       int
+    requests          int
+    duration          time.Duration
+    connections       int
+    rate              int
+    orderByCompletion bool
 }
 
 func main() {
-    arguments, err := docopt.Parse(usage, nil, true, "msgpack-cli "+__VERSION__, false)
+    parser := &docopt.Parser{HelpHandler: printHelpAndExit}
+    arguments, err := parser.ParseArgs(usage, nil, "msgpack-cli "+__VERSION__)
     if err != nil {
-        log.Fatal(fmt.Errorf("Arguments parsing: %s", err))
+        log.Print(fmt.Errorf("Arguments parsing: %s", err))
+        os.Exit(exitUsage)
     }
 
+    ctx, cancel := interruptContext()
+    defer cancel()
+
     switch {
-    case arguments["encode"], arguments["decode"]:
+    case arguments["encode"], arguments["decode"], arguments["convert"]:
         var inFilename string
         if arguments["<input-file>"] != nil {
             inFilename = arguments["<input-file>"].(string)
@@ -79,45 +368,300 @@ func main() {
 
         outFilename, _ := arguments["--out"].(string)
 
-        conversionFunc := ConvertJSON2Msgpack
+        from, to := "json", "msgpack"
         if arguments["decode"].(bool) {
-            conversionFunc = ConvertMsgpack2JSON
+            from, to = "msgpack", "json"
+        }
+        if format, ok := arguments["--from"].(string); ok {
+            from = format
+        }
+        if format, ok := arguments["--to"].(string); ok {
+            to = format
         }
 
         options := Options{
             convertToInt64: !arguments["--disable-int64-conv"].(bool),
             indent:         arguments["--pp"].(bool),
+            inEncoding:     arguments["--in-encoding"].(string),
+            outEncoding:    arguments["--out-encoding"].(string),
+        }
+        options.schemaFile, _ = arguments["--schema"].(string)
+        options.compression, _ = arguments["--compress"].(string)
+
+        err = ConvertFormats(inFilename, outFilename, from, to, options)
+    case arguments["formats"]:
+        PrintFormats()
+    case arguments["gen-types"]:
+        options := Options{
+            typeName:    arguments["--name"].(string),
+            packageName: arguments["--package"].(string),
         }
 
-        err = ConvertFormats(inFilename, outFilename, conversionFunc, options)
+        err = GenerateTypes(arguments["<sample-file>"].([]string), options)
+    case arguments["infer-schema"]:
+        err = InferSchema(arguments["<sample-file>"].([]string))
+    case arguments["edit"]:
+        var operations []editOperation
+        if operations, err = getEditOperations(arguments); err != nil {
+            break
+        }
+        outFilename, _ := arguments["--out"].(string)
+
+        err = EditMsgpack(arguments["<input-file>"].(string), outFilename, operations)
     case arguments["rpc"]:
         host := arguments["<host>"].(string)
         port := arguments["<port>"].(string)
+        var timeout time.Duration
+        timeout, err = getDuration(arguments, "--timeout")
+        if err != nil {
+            break
+        }
+
+        if batch, ok := arguments["--batch"].(string); ok {
+            options := Options{
+                convertToInt64: !arguments["--disable-int64-conv"].(bool),
+                timeout:        timeout,
+            }
+            options.inflight, options.orderByCompletion, err = getBatchOptions(arguments)
+            if err != nil {
+                break
+            }
+            if err = setDialOptions(arguments, &options); err != nil {
+                break
+            }
+
+            err = BatchRPC(ctx, host, port, batch, options)
+            break
+        }
+
+        method := arguments["<method>"].(string)
+        options := Options{
+            convertToInt64: !arguments["--disable-int64-conv"].(bool),
+            indent:         arguments["--pp"].(bool),
+            timeout:        timeout,
+            errorToStdout:  arguments["--error-stdout"].(bool),
+            notifications:  arguments["--notifications"].(bool),
+            requestError:   arguments["--request-error"].(string),
+            args:           arguments["--arg"].([]string),
+            mapParams:      arguments["--map-params"].(bool),
+            rawReply:       arguments["--raw-reply"].(bool),
+        }
+
+        if options.watch, err = getDuration(arguments, "--watch"); err != nil {
+            break
+        }
+
+        var params string
+        if options.msgpackParams, err = getParamsFormat(arguments); err != nil {
+            break
+        }
+        if options.msgpackParams {
+            params, err = getMsgpackParams(arguments)
+        } else {
+            params, err = getRPCParams(arguments)
+        }
+        if err != nil {
+            break
+        }
+
+        options.handlersFile, _ = arguments["--handlers"].(string)
+        options.until, _ = arguments["--until"].(string)
+        options.record, _ = arguments["--record"].(string)
+        options.compression, _ = arguments["--compress"].(string)
+        if err = setDialOptions(arguments, &options); err != nil {
+            break
+        }
+
+        if options.watch > 0 {
+            if err = setWatchOptions(arguments, &options); err != nil {
+                break
+            }
+            err = WatchRPC(ctx, host, port, method, params, options)
+            break
+        }
+
+        err = CallRPC(ctx, host, port, method, params, options)
+    case arguments["fanout"]:
         method := arguments["<method>"].(string)
+        var hosts []string
+        if hosts, err = expandHosts(arguments["<hosts>"].(string)); err != nil {
+            break
+        }
         var params string
         params, err = getRPCParams(arguments)
         if err != nil {
             break
         }
-        var timeout uint32
-        timeout, err = getTimeout(arguments)
+
+        options := Options{
+            convertToInt64: !arguments["--disable-int64-conv"].(bool),
+            args:           arguments["--arg"].([]string),
+            mapParams:      arguments["--map-params"].(bool),
+        }
+        if options.timeout, err = getDuration(arguments, "--timeout"); err != nil {
+            break
+        }
+        if options.inflight, err = getCount(arguments, "--inflight", 1); err != nil {
+            break
+        }
+        if err = setDialOptions(arguments, &options); err != nil {
+            break
+        }
+
+        err = FanOut(ctx, hosts, method, params, options)
+    case arguments["listen"]:
+        host := arguments["<host>"].(string)
+        port := arguments["<port>"].(string)
+        method, _ := arguments["<method>"].(string)
+        var params string
+        params, err = getRPCParams(arguments)
         if err != nil {
             break
         }
 
+        options := Options{
+            convertToInt64: !arguments["--disable-int64-conv"].(bool),
+            errorToStdout:  arguments["--error-stdout"].(bool),
+            requestError:   arguments["--request-error"].(string),
+            args:           arguments["--arg"].([]string),
+            mapParams:      arguments["--map-params"].(bool),
+        }
+        options.handlersFile, _ = arguments["--handlers"].(string)
+        if options.timeout, err = getDuration(arguments, "--timeout"); err != nil {
+            break
+        }
+        if options.idleTimeout, err = getDuration(arguments, "--idle-timeout"); err != nil {
+            break
+        }
+        if err = setDialOptions(arguments, &options); err != nil {
+            break
+        }
+
+        err = Listen(ctx, host, port, method, params, options)
+    case arguments["describe"]:
+        host := arguments["<host>"].(string)
+        port := arguments["<port>"].(string)
+
+        options := Options{
+            convertToInt64: !arguments["--disable-int64-conv"].(bool),
+            indent:         arguments["--pp"].(bool),
+            discovery:      arguments["--discovery"].(string),
+            methodNames:    arguments["--names"].(bool),
+            jsonOutput:     arguments["--json"].(bool),
+        }
+        options.cacheFile, _ = arguments["--cache"].(string)
+        if options.cacheTTL, err = getDuration(arguments, "--cache-ttl"); err != nil {
+            break
+        }
+        if options.timeout, err = getDuration(arguments, "--timeout"); err != nil {
+            break
+        }
+        if err = setDialOptions(arguments, &options); err != nil {
+            break
+        }
+
+        err = Describe(ctx, host, port, options)
+    case arguments["bench"]:
+        host := arguments["<host>"].(string)
+        port := arguments["<port>"].(string)
+        method := arguments["<method>"].(string)
+        var params string
+        params, err = getRPCParams(arguments)
+        if err != nil {
+            break
+        }
+
+        options := Options{
+            convertToInt64: !arguments["--disable-int64-conv"].(bool),
+            indent:         arguments["--pp"].(bool),
+            args:           arguments["--arg"].([]string),
+            mapParams:      arguments["--map-params"].(bool),
+        }
+        if options.timeout, err = getDuration(arguments, "--timeout"); err != nil {
+            break
+        }
+        if options.duration, err = getDuration(arguments, "--duration"); err != nil {
+            break
+        }
+        if options.concurrency, err = getCount(arguments, "--concurrency", 1); err != nil {
+            break
+        }
+        if options.requests, err = getCount(arguments, "--requests", 1); err != nil {
+            break
+        }
+        if options.connections, err = getCount(arguments, "--connections", 1); err != nil {
+            break
+        }
+        if options.rate, err = getCount(arguments, "--rate", 0); err != nil {
+            break
+        }
+        if options.rate > maxBenchRate {
+            err = usageError(fmt.Errorf("Invalid value of --rate: %d, maximum is %d", options.rate, maxBenchRate))
+            break
+        }
+
+        err = Bench(ctx, host, port, method, params, options)
+    case arguments["replay"]:
+        filename := arguments["<session-file>"].(string)
+
+        if address, ok := arguments["--serve"].(string); ok {
+            err = ServeSession(ctx, filename, address)
+            break
+        }
+
+        host := arguments["<host>"].(string)
+        port := arguments["<port>"].(string)
+        options := Options{}
+        if options.timeout, err = getDuration(arguments, "--timeout"); err != nil {
+            break
+        }
+
+        err = Replay(ctx, filename, host, port, options)
+    case arguments["proxy"]:
+        address := arguments["<address>"].(string)
+        host := arguments["<host>"].(string)
+        port := arguments["<port>"].(string)
+
+        var options Options
+        if options.delays, options.failures, err = getProxyOptions(arguments); err != nil {
+            break
+        }
+
+        err = Proxy(ctx, address, host, port, options)
+    case arguments["gateway"]:
+        address := arguments["<address>"].(string)
+        host := arguments["<host>"].(string)
+        port := arguments["<port>"].(string)
+
         options := Options{
             convertToInt64: !arguments["--disable-int64-conv"].(bool),
             indent:         arguments["--pp"].(bool),
-            timeout:        timeout,
+        }
+        if options.timeout, err = getDuration(arguments, "--timeout"); err != nil {
+            break
         }
 
-        err = CallRPC(host, port, method, params, options)
+        err = Gateway(ctx, address, host, port, options)
     default:
         panic("unreachable")
     }
     if err != nil {
-        log.Fatal(err)
+        // error object returned by RPC server has been already written
+        var remoteErr *rpcclient.RemoteError
+        if !errors.As(err, &remoteErr) {
+            log.Print(err)
+        }
+        os.Exit(exitCode(err))
+    }
+}
+
+func printHelpAndExit(err error, usage string) {
+    if err != nil {
+        fmt.Fprintln(os.Stderr, usage)
+        os.Exit(exitUsage)
     }
+    fmt.Println(usage)
+    os.Exit(0)
 }
 
 func getRPCParams(arguments map[string]interface{}) (params string, err error) {
@@ -125,7 +669,7 @@ func getRPCParams(arguments map[string]interface{}) (params string, err error) {
     filename, _ := arguments["--file"].(string)
 
     if filename != "" {
-        buff, err := ioutil.ReadFile(filename)
+        buff, err := readParamsFile(filename)
         if err != nil {
             return "", err
         }
@@ -135,12 +679,229 @@ func getRPCParams(arguments map[string]interface{}) (params string, err error) {
     return params, nil
 }
 
-func getTimeout(arguments map[string]interface{}) (timeout uint32, err error) {
-    timeout = uint32(30)
-    if str := arguments["--timeout"].(string); str != "" {
-        var tmp uint64
-        tmp, err = strconv.ParseUint(str, 10, 32)
-        timeout = uint32(tmp)
+// readParamsFile returns content of params file, decompressed if it's
+// compressed.
+func readParamsFile(filename string) ([]byte, error) {
+    buff, err := ioutil.ReadFile(filename)
+    if err != nil {
+        return nil, err
+    }
+    if buff, err = convert.Decompress(buff); err != nil {
+        return nil, decodeError(fmt.Errorf("Params file: %s", err))
+    }
+    return buff, nil
+}
+
+// getEditOperations returns operations of edit command, sets are followed by
+// appends and deletions.
+func getEditOperations(arguments map[string]interface{}) ([]editOperation, error) {
+    var operations []editOperation
+
+    for _, option := range []struct {
+        name string
+        kind editKind
+    }{
+        {"--set", editSet}, {"--append", editAppend}, {"--delete", editDelete},
+    } {
+        for _, spec := range arguments[option.name].([]string) {
+            operation, err := parseEditOperation(option.kind, spec)
+            if err != nil {
+                return nil, err
+            }
+            operations = append(operations, operation)
+        }
+    }
+
+    return operations, nil
+}
+
+// setWatchOptions sets options of repeated calls.
+func setWatchOptions(arguments map[string]interface{}, options *Options) (err error) {
+    if options.notifications {
+        return usageError(fmt.Errorf("Notifications can't be written in watch mode"))
+    }
+
+    options.diff = arguments["--diff"].(bool)
+    options.changesOnly = arguments["--changes"].(bool) || options.diff
+    if options.count, err = getCount(arguments, "--count", 0); err != nil {
+        return err
+    }
+
+    if condition, ok := arguments["--watch-until"].(string); ok {
+        parts := strings.SplitN(condition, "=", 2)
+        if len(parts) != 2 {
+            return usageError(fmt.Errorf("Invalid condition %s, expected <path>=<value>", condition))
+        }
+        if options.untilPath, err = parseJSONPath(parts[0]); err != nil {
+            return usageError(err)
+        }
+        if options.untilValue, err = decodeRPCParams(parts[1], options.convertToInt64); err != nil {
+            return usageError(fmt.Errorf("Invalid value of condition %s: %s", condition, err))
+        }
+    }
+
+    return nil
+}
+
+// getParamsFormat returns true if params are in msgpack format.
+func getParamsFormat(arguments map[string]interface{}) (msgpackParams bool, err error) {
+    switch format := arguments["--params-format"].(string); format {
+    case "json":
+        return false, nil
+    case "msgpack":
+        return true, nil
+    default:
+        return false, usageError(fmt.Errorf("Invalid format of params: %s", format))
     }
-    return timeout, err
+}
+
+// getMsgpackParams reads params in msgpack format from file or STDIN.
+func getMsgpackParams(arguments map[string]interface{}) (params string, err error) {
+    if args, _ := arguments["--arg"].([]string); len(args) > 0 {
+        return "", usageError(fmt.Errorf("Params in msgpack format can't be combined with --arg"))
+    }
+    if arguments["<params>"] != nil {
+        return "", usageError(fmt.Errorf("Params in msgpack format must be read from file or STDIN"))
+    }
+
+    var buff []byte
+    if filename, _ := arguments["--file"].(string); filename != "" {
+        buff, err = readParamsFile(filename)
+    } else {
+        buff, err = ioutil.ReadAll(os.Stdin)
+    }
+    if err != nil {
+        return "", err
+    }
+
+    return string(buff), nil
+}
+
+// interruptContext returns context which is cancelled on SIGINT.
+func interruptContext() (context.Context, context.CancelFunc) {
+    ctx, cancel := context.WithCancel(context.Background())
+
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, os.Interrupt)
+
+    go func() {
+        select {
+        case <-signals:
+            cancel()
+        case <-ctx.Done():
+        }
+        signal.Stop(signals)
+    }()
+
+    return ctx, cancel
+}
+
+// getDuration parses duration option given either as number of seconds or as
+// duration string like 250ms or 1m30s.
+func getDuration(arguments map[string]interface{}, name string) (duration time.Duration, err error) {
+    str, _ := arguments[name].(string)
+    if str == "" {
+        return 0, nil
+    }
+
+    if seconds, err := strconv.ParseUint(str, 10, 32); err == nil {
+        return time.Duration(seconds) * time.Second, nil
+    }
+    if duration, err = time.ParseDuration(str); err != nil {
+        return 0, usageError(err)
+    }
+    if duration < 0 {
+        return 0, usageError(fmt.Errorf("Invalid value of %s: %s", name, str))
+    }
+    return duration, nil
+}
+
+func setDialOptions(arguments map[string]interface{}, options *Options) (err error) {
+    if options.retries, err = getCount(arguments, "--retries", 0); err != nil {
+        return err
+    }
+    if options.backoff, err = time.ParseDuration(arguments["--backoff"].(string)); err != nil {
+        return usageError(err)
+    }
+    if options.connectTimeout, err = getDuration(arguments, "--connect-timeout"); err != nil {
+        return err
+    }
+    if options.readTimeout, err = getDuration(arguments, "--read-timeout"); err != nil {
+        return err
+    }
+    if options.writeTimeout, err = getDuration(arguments, "--write-timeout"); err != nil {
+        return err
+    }
+
+    options.fallbacks = arguments["--fallback"].([]string)
+    for _, endpoint := range options.fallbacks {
+        if _, _, err = net.SplitHostPort(endpoint); err != nil {
+            return usageError(err)
+        }
+    }
+
+    return nil
+}
+
+func getProxyOptions(arguments map[string]interface{}) (delays map[string]time.Duration,
+    failures map[string]string, err error) {
+
+    delays = make(map[string]time.Duration)
+    failures = make(map[string]string)
+
+    for _, option := range arguments["--delay"].([]string) {
+        method, value, err := splitMethodValue(option)
+        if err != nil {
+            return nil, nil, err
+        }
+        if delays[method], err = time.ParseDuration(value); err != nil {
+            return nil, nil, usageError(err)
+        }
+    }
+
+    for _, option := range arguments["--fail"].([]string) {
+        method, value, err := splitMethodValue(option)
+        if err != nil {
+            return nil, nil, err
+        }
+        failures[method] = value
+    }
+
+    return delays, failures, nil
+}
+
+// splitMethodValue splits option value in form <method>=<value>.
+func splitMethodValue(option string) (method, value string, err error) {
+    parts := strings.SplitN(option, "=", 2)
+    if len(parts) != 2 || parts[0] == "" {
+        return "", "", usageError(fmt.Errorf("Invalid value %s, expected <method>=<value>", option))
+    }
+    return parts[0], parts[1], nil
+}
+
+// getCount parses integer option which must not be lower than min.
+func getCount(arguments map[string]interface{}, name string, min int) (count int, err error) {
+    if count, err = strconv.Atoi(arguments[name].(string)); err != nil {
+        return 0, usageError(err)
+    }
+    if count < min {
+        return 0, usageError(fmt.Errorf("Invalid value of %s: %d", name, count))
+    }
+    return count, nil
+}
+
+func getBatchOptions(arguments map[string]interface{}) (inflight int, orderByCompletion bool, err error) {
+    if inflight, err = getCount(arguments, "--inflight", 1); err != nil {
+        return 0, false, err
+    }
+
+    switch order := arguments["--order"].(string); order {
+    case "request":
+    case "completion":
+        orderByCompletion = true
+    default:
+        return 0, false, usageError(fmt.Errorf("Invalid order of batch results: %s", order))
+    }
+
+    return inflight, orderByCompletion, nil
 }
@@ -0,0 +1,138 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "io/ioutil"
+    "net"
+    "os"
+    "testing"
+    "time"
+)
+
+// serveEcho answers requests on conn by their params, method fail fails and
+// method sleep is never answered.
+func serveEcho(conn net.Conn) {
+    defer conn.Close()
+
+    decoder := convert.NewMsgpackDecoder(conn)
+    encoder := convert.NewMsgpackEncoder(conn)
+    for {
+        var frame []interface{}
+        if err := decoder.Decode(&frame); err != nil {
+            return
+        }
+        response := []interface{}{rpcclient.Response, frame[1], nil, frame[3]}
+        switch frame[2] {
+        case "fail":
+            response[2], response[3] = "boom", nil
+        case "sleep":
+            continue
+        }
+        if err := encoder.Encode(response); err != nil {
+            return
+        }
+    }
+}
+
+// listenEcho serves every connection accepted on a local address by
+// serveEcho and returns host and port of it.
+func listenEcho(t *testing.T) (host, port string) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { listener.Close() })
+
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            go serveEcho(conn)
+        }
+    }()
+
+    host, port, _ = net.SplitHostPort(listener.Addr().String())
+    return host, port
+}
+
+// tempDir returns directory removed when test finishes.
+func tempDir(t *testing.T) string {
+    dir, err := ioutil.TempDir("", "msgpack-cli")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { os.RemoveAll(dir) })
+    return dir
+}
+
+// captureStdout returns everything written to STDOUT by f.
+func captureStdout(t *testing.T, f func()) string {
+    reader, writer, err := os.Pipe()
+    if err != nil {
+        t.Fatal(err)
+    }
+    stdout := os.Stdout
+    os.Stdout = writer
+    defer func() { os.Stdout = stdout }()
+
+    output := make(chan string)
+    go func() {
+        data, _ := ioutil.ReadAll(reader)
+        output <- string(data)
+    }()
+
+    f()
+    writer.Close()
+    return <-output
+}
+
+func TestGetDuration(t *testing.T) {
+    for _, test := range []struct {
+        value    interface{}
+        duration time.Duration
+        code     int
+    }{
+        {nil, 0, 0},
+        {"", 0, 0},
+        {"5", 5 * time.Second, 0},
+        {"0", 0, 0},
+        {"1.5s", 1500 * time.Millisecond, 0},
+        {"100ms", 100 * time.Millisecond, 0},
+        {"-1s", 0, exitUsage},
+        {"-1", 0, exitUsage},
+        {"5x", 0, exitUsage},
+    } {
+        arguments := map[string]interface{}{"--timeout": test.value}
+        duration, err := getDuration(arguments, "--timeout")
+        if err != nil && exitCode(err) != test.code || err == nil && test.code != 0 {
+            t.Fatalf("Duration %#v returned error %v", test.value, err)
+        }
+        if duration != test.duration {
+            t.Fatalf("Duration %#v was parsed as %s, expected %s", test.value, duration, test.duration)
+        }
+    }
+}
+
+func TestGetMsgpackParamsRejectsArgs(t *testing.T) {
+    arguments := map[string]interface{}{"--arg": []string{"int:1"}, "<params>": nil, "--file": nil}
+    if _, err := getMsgpackParams(arguments); exitCode(err) != exitUsage {
+        t.Fatalf("Msgpack params were combined with --arg: %v", err)
+    }
+}
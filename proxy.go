@@ -0,0 +1,216 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "log"
+    "net"
+    "sync"
+    "time"
+)
+
+type proxyLogEntry struct {
+    Time      string      `json:"time"`
+    Direction string      `json:"direction"`
+    Type      string      `json:"type"`
+    Msgid     interface{} `json:"msgid,omitempty"`
+    Method    string      `json:"method,omitempty"`
+    Params    interface{} `json:"params,omitempty"`
+    Error     interface{} `json:"error,omitempty"`
+    Result    interface{} `json:"result,omitempty"`
+    Latency   *float64    `json:"latency,omitempty"`
+    Injected  string      `json:"injected,omitempty"`
+}
+
+// proxyConn writes frames to one side of proxied connection.
+type proxyConn struct {
+    conn  net.Conn
+    mutex sync.Mutex
+}
+
+func (c *proxyConn) write(data []byte) error {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    _, err := c.conn.Write(data)
+    return err
+}
+
+type proxyRequest struct {
+    method string
+    start  time.Time
+}
+
+// proxySession forwards frames of one client connection. Requests are
+// tracked separately for both directions, because server may call client too.
+type proxySession struct {
+    client   *proxyConn
+    upstream *proxyConn
+    options  Options
+    mutex    sync.Mutex
+    pending  map[string]map[uint32]proxyRequest
+}
+
+var proxyLogMutex sync.Mutex
+
+// Proxy listens on address and forwards msgpack-rpc connections to upstream
+// server. Every frame is written to STDOUT as JSON line with its direction,
+// type and latency of response in milliseconds. Requests of methods from
+// options.delays are forwarded late and requests of methods from
+// options.failures are answered with error without forwarding. Proxy stops
+// when ctx is done.
+func Proxy(ctx context.Context, address, host, port string, options Options) (err error) {
+    listener, err := net.Listen("tcp", address)
+    if err != nil {
+        return connectionError(err)
+    }
+    defer listener.Close()
+    go closeWhenDone(ctx, listener)
+
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            if ctx.Err() != nil {
+                return nil
+            }
+            return connectionError(err)
+        }
+
+        go func() {
+            upstream, err := dialRPC(ctx, host, port, options)
+            if err != nil {
+                log.Print(err)
+                conn.Close()
+                return
+            }
+
+            newProxySession(conn, upstream, options).run()
+        }()
+    }
+}
+
+func newProxySession(client, upstream net.Conn, options Options) *proxySession {
+    return &proxySession{
+        client:   &proxyConn{conn: client},
+        upstream: &proxyConn{conn: upstream},
+        options:  options,
+        pending: map[string]map[uint32]proxyRequest{
+            "to-server": make(map[uint32]proxyRequest),
+            "to-client": make(map[uint32]proxyRequest),
+        },
+    }
+}
+
+// run forwards frames in both directions until connection is closed.
+func (s *proxySession) run() {
+    go s.forward(s.upstream, s.client, "to-client", "to-server")
+    s.forward(s.client, s.upstream, "to-server", "to-client")
+}
+
+// forward reads frames from src and writes them to dst until either side of
+// connection is closed.
+func (s *proxySession) forward(src, dst *proxyConn, direction, reverse string) {
+    defer src.conn.Close()
+    defer dst.conn.Close()
+
+    decoder := convert.NewMsgpackDecoder(bufio.NewReader(src.conn))
+
+    for {
+        data, err := convert.DecodeRawMsgpack(decoder)
+        if err != nil {
+            return
+        }
+
+        var frame []interface{}
+        if err = convert.DecodeMsgpack(data, &frame); err != nil || len(frame) == 0 {
+            // not a msgpack-rpc frame, just pass it
+            if dst.write(data) != nil {
+                return
+            }
+            continue
+        }
+
+        entry := proxyLogEntry{Time: time.Now().Format(time.RFC3339Nano), Direction: direction}
+        kind, _ := rpcclient.ParseUint32(frame[0])
+
+        switch {
+        case kind == rpcclient.Request && len(frame) == 4:
+            entry.Type, entry.Msgid, entry.Params = "request", frame[1], frame[3]
+            entry.Method, _ = frame[2].(string)
+            msgid, _ := rpcclient.ParseUint32(frame[1])
+
+            if failure, ok := s.options.failures[entry.Method]; ok && direction == "to-server" {
+                entry.Injected = "error"
+                writeProxyLog(entry)
+                s.inject(src, msgid, failure)
+                continue
+            }
+
+            s.mutex.Lock()
+            s.pending[direction][msgid] = proxyRequest{entry.Method, time.Now()}
+            s.mutex.Unlock()
+
+            if delay, ok := s.options.delays[entry.Method]; ok && direction == "to-server" {
+                entry.Injected = "delay"
+                writeProxyLog(entry)
+                time.AfterFunc(delay, func() { dst.write(data) })
+                continue
+            }
+        case kind == rpcclient.Response && len(frame) == 4:
+            entry.Type, entry.Msgid, entry.Error, entry.Result = "response", frame[1], frame[2], frame[3]
+            msgid, _ := rpcclient.ParseUint32(frame[1])
+
+            s.mutex.Lock()
+            if request, ok := s.pending[reverse][msgid]; ok {
+                latency := milliseconds(time.Since(request.start))
+                entry.Method, entry.Latency = request.method, &latency
+                delete(s.pending[reverse], msgid)
+            }
+            s.mutex.Unlock()
+        case kind == rpcclient.Notification && len(frame) == 3:
+            entry.Type, entry.Params = "notification", frame[2]
+            entry.Method, _ = frame[1].(string)
+        default:
+            entry.Type, entry.Params = "unknown", frame
+        }
+
+        writeProxyLog(entry)
+        if dst.write(data) != nil {
+            return
+        }
+    }
+}
+
+// inject answers request with error on behalf of upstream server.
+func (s *proxySession) inject(client *proxyConn, msgid uint32, failure string) {
+    var buffer []byte
+    encoder := convert.NewMsgpackEncoderBytes(&buffer)
+    if err := encoder.Encode([]interface{}{rpcclient.Response, msgid, failure, nil}); err == nil {
+        client.write(buffer)
+    }
+}
+
+func writeProxyLog(entry proxyLogEntry) {
+    proxyLogMutex.Lock()
+    defer proxyLogMutex.Unlock()
+
+    if data, err := encodeRPCReply(entry, false); err == nil {
+        fmt.Print(data)
+    }
+}
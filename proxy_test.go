@@ -0,0 +1,79 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "net"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestProxyForwardsCall(t *testing.T) {
+    clientConn, proxyConn := net.Pipe()
+    upstreamConn, serverConn := net.Pipe()
+    go serveEcho(serverConn)
+
+    options := Options{failures: map[string]string{"broken": "injected"}}
+    done := make(chan struct{})
+
+    output := captureStdout(t, func() {
+        go func() {
+            newProxySession(proxyConn, upstreamConn, options).run()
+            close(done)
+        }()
+
+        client := rpcclient.NewClient(clientConn, nil, nil)
+        reply, err := client.Go("echo", []interface{}{"a"}, nil).Wait(context.Background())
+        if err != nil || !reflect.DeepEqual(reply, []interface{}{"a"}) {
+            t.Errorf("Forwarded call returned %#v %v", reply, err)
+        }
+        if _, err = client.Go("broken", []interface{}{}, nil).Wait(context.Background()); err == nil {
+            t.Error("Injected failure wasn't returned")
+        }
+        client.Close()
+        <-done
+    })
+
+    var entries []proxyLogEntry
+    for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+        var entry proxyLogEntry
+        if err := json.Unmarshal([]byte(line), &entry); err != nil {
+            t.Fatalf("Invalid log line %q: %s", line, err)
+        }
+        entries = append(entries, entry)
+    }
+
+    if len(entries) != 3 {
+        t.Fatalf("Proxy logged %d frames, expected 3:\n%s", len(entries), output)
+    }
+    for i, expected := range []proxyLogEntry{
+        {Direction: "to-server", Type: "request", Method: "echo"},
+        {Direction: "to-client", Type: "response", Method: "echo"},
+        {Direction: "to-server", Type: "request", Method: "broken", Injected: "error"},
+    } {
+        entry := entries[i]
+        if entry.Direction != expected.Direction || entry.Type != expected.Type ||
+            entry.Method != expected.Method || entry.Injected != expected.Injected {
+            t.Fatalf("Frame %d was logged as %+v, expected %+v", i, entry, expected)
+        }
+    }
+    if entries[1].Latency == nil || !reflect.DeepEqual(entries[1].Result, []interface{}{"a"}) {
+        t.Fatalf("Response was logged as %+v", entries[1])
+    }
+}
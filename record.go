@@ -0,0 +1,331 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "fmt"
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "io"
+    "log"
+    "net"
+    "os"
+    "reflect"
+    "sync"
+    "time"
+)
+
+// sessionRecord is a frame of recorded session. Session file is a stream of
+// msgpack encoded records.
+type sessionRecord struct {
+    Time     string        `codec:"time"`
+    Outgoing bool          `codec:"outgoing"`
+    Frame    []interface{} `codec:"frame"`
+}
+
+type sessionRecorder struct {
+    file       *os.File
+    compressor io.WriteCloser
+    encoder    convert.Encoder
+    mutex      sync.Mutex
+}
+
+func (r *sessionRecorder) RecordFrame(outgoing bool, frame []interface{}) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+
+    record := sessionRecord{time.Now().Format(time.RFC3339Nano), outgoing, frame}
+    if err := r.encoder.Encode(record); err != nil {
+        log.Printf("Recording of frame failed: %s", err)
+    }
+}
+
+func (r *sessionRecorder) Close() error {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+
+    if err := r.compressor.Close(); err != nil {
+        r.file.Close()
+        return err
+    }
+    return r.file.Close()
+}
+
+// newSessionRecorder returns recorder writing session to file, compressed by
+// compression if it isn't empty.
+func newSessionRecorder(filename, compression string) (*sessionRecorder, error) {
+    if compression != "" {
+        if err := convert.CheckCompression(compression); err != nil {
+            return nil, usageError(err)
+        }
+    }
+
+    file, err := os.Create(filename)
+    if err != nil {
+        return nil, err
+    }
+    compressor, _ := convert.NewCompressingWriter(file, compression)
+    return &sessionRecorder{file: file, compressor: compressor, encoder: convert.NewMsgpackEncoder(compressor)}, nil
+}
+
+// recordedCall is a request sent by client in recorded session and reply
+// to it, if any.
+type recordedCall struct {
+    msgid     interface{}
+    method    string
+    params    interface{}
+    replied   bool
+    remoteErr interface{}
+    reply     interface{}
+}
+
+// readSession returns calls recorded in session file, which may be
+// compressed.
+func readSession(filename string) (calls []*recordedCall, err error) {
+    file, err := os.Open(filename)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    reader, err := convert.NewDecompressingReader(file)
+    if err != nil {
+        return nil, decodeError(fmt.Errorf("Session file: %s", err))
+    }
+    defer reader.Close()
+
+    requests := make(map[uint32]*recordedCall)
+    decoder := convert.NewMsgpackDecoder(reader)
+
+    for {
+        var record sessionRecord
+        if err = decoder.Decode(&record); err != nil {
+            if err == io.EOF {
+                break
+            }
+            return nil, decodeError(fmt.Errorf("Session file: %s", err))
+        }
+
+        frame := record.Frame
+        if len(frame) != 4 {
+            continue
+        }
+        kind, _ := rpcclient.ParseUint32(frame[0])
+        msgid, ok := rpcclient.ParseUint32(frame[1])
+        if !ok {
+            continue
+        }
+
+        switch {
+        case record.Outgoing && kind == rpcclient.Request:
+            method, _ := frame[2].(string)
+            call := &recordedCall{msgid: msgid, method: method, params: frame[3]}
+            requests[msgid] = call
+            calls = append(calls, call)
+        case !record.Outgoing && kind == rpcclient.Response:
+            if call, ok := requests[msgid]; ok {
+                call.replied = true
+                call.remoteErr = frame[2]
+                call.reply = frame[3]
+                delete(requests, msgid)
+            }
+        }
+    }
+
+    return calls, nil
+}
+
+type replayReply struct {
+    Error  interface{} `json:"error"`
+    Result interface{} `json:"result"`
+}
+
+type replayResult struct {
+    Msgid    interface{}  `json:"msgid"`
+    Method   string       `json:"method"`
+    Match    bool         `json:"match"`
+    Expected *replayReply `json:"expected,omitempty"`
+    Actual   *replayReply `json:"actual,omitempty"`
+}
+
+// Replay issues requests of recorded session again and compares replies with
+// recorded ones. Result of every request is written to STDOUT as JSON line,
+// expected and actual replies are included only if they differ.
+func Replay(ctx context.Context, filename, host, port string, options Options) (err error) {
+    var (
+        calls []*recordedCall
+        conn  net.Conn
+    )
+
+    if calls, err = readSession(filename); err != nil {
+        return err
+    }
+
+    if conn, err = dialRPC(ctx, host, port, options); err != nil {
+        return err
+    }
+    client := rpcclient.NewClient(conn, nil, nil)
+    defer client.Close()
+
+    var mismatches int
+
+    for _, recorded := range calls {
+        if !recorded.replied {
+            continue
+        }
+
+        callCtx, cancel := withTimeout(ctx, options.timeout)
+        stop := closeIfCancelled(callCtx, client)
+        call := client.Go(recorded.method, recorded.params, nil)
+        stop()
+        actual := &replayReply{}
+
+        select {
+        case <-call.Done:
+            cancel()
+            if call.Err != nil {
+                return call.Err
+            }
+            actual.Error, actual.Result = call.RemoteErr, call.Reply
+        case <-callCtx.Done():
+            cancel()
+            return contextError(callCtx)
+        }
+
+        expected := &replayReply{recorded.remoteErr, recorded.reply}
+        result := replayResult{Msgid: recorded.msgid, Method: recorded.method}
+        if result.Match = reflect.DeepEqual(expected, actual); !result.Match {
+            result.Expected, result.Actual = expected, actual
+            mismatches++
+        }
+
+        data, err := encodeRPCReply(result, false)
+        if err != nil {
+            return err
+        }
+        fmt.Print(data)
+    }
+
+    if mismatches > 0 {
+        return fmt.Errorf("%d replies differ from recorded session", mismatches)
+    }
+
+    return nil
+}
+
+// ServeSession listens on address and answers requests with replies from
+// recorded session. Request is matched by method and params first, then by
+// method only in recorded order. ServeSession stops when ctx is done.
+func ServeSession(ctx context.Context, filename, address string) (err error) {
+    var (
+        calls    []*recordedCall
+        listener net.Listener
+    )
+
+    if calls, err = readSession(filename); err != nil {
+        return err
+    }
+
+    if listener, err = net.Listen("tcp", address); err != nil {
+        return connectionError(err)
+    }
+    defer listener.Close()
+    go closeWhenDone(ctx, listener)
+
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            if ctx.Err() != nil {
+                return nil
+            }
+            return connectionError(err)
+        }
+        go serveSessionConn(conn, calls)
+    }
+}
+
+func serveSessionConn(conn net.Conn, calls []*recordedCall) {
+    defer conn.Close()
+
+    decoder := convert.NewMsgpackDecoder(conn)
+    encoder := convert.NewMsgpackEncoder(conn)
+    cursor := newReplayCursor()
+
+    for {
+        var frame []interface{}
+        if err := decoder.Decode(&frame); err != nil {
+            return
+        }
+        if len(frame) != 4 {
+            continue
+        }
+        if kind, _ := rpcclient.ParseUint32(frame[0]); kind != rpcclient.Request {
+            continue
+        }
+        method, _ := frame[2].(string)
+
+        var reply interface{} = fmt.Sprintf("No recorded reply of method %s", method)
+        response := []interface{}{rpcclient.Response, frame[1], reply, nil}
+
+        if call := findRecordedCall(calls, method, frame[3], cursor); call != nil {
+            response[2], response[3] = call.remoteErr, call.reply
+        }
+
+        if err := encoder.Encode(response); err != nil {
+            return
+        }
+    }
+}
+
+// replayCursor counts replays of recorded calls, so that repeated requests
+// get replies in recorded order.
+type replayCursor struct {
+    // methods counts requests matched by method only
+    methods map[string]int
+    // params counts requests matched exactly, by the first matching call
+    params map[*recordedCall]int
+}
+
+func newReplayCursor() *replayCursor {
+    return &replayCursor{methods: make(map[string]int), params: make(map[*recordedCall]int)}
+}
+
+// findRecordedCall returns the next call recorded with the same method and
+// params, or the next call of the same method if there is none.
+func findRecordedCall(calls []*recordedCall, method string, params interface{}, cursor *replayCursor) *recordedCall {
+    var matches, candidates []*recordedCall
+    for _, call := range calls {
+        if call.replied && call.method == method {
+            candidates = append(candidates, call)
+            if reflect.DeepEqual(call.params, params) {
+                matches = append(matches, call)
+            }
+        }
+    }
+
+    if len(matches) > 0 {
+        call := matches[cursor.params[matches[0]]%len(matches)]
+        cursor.params[matches[0]]++
+        return call
+    }
+    if len(candidates) == 0 {
+        return nil
+    }
+
+    call := candidates[cursor.methods[method]%len(candidates)]
+    cursor.methods[method]++
+    return call
+}
@@ -0,0 +1,107 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "net"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func callReply(t *testing.T, client rpcclient.Client, method string, params interface{}) *replayReply {
+    call := client.Go(method, params, nil)
+    if _, err := call.Wait(context.Background()); err != nil && call.RemoteErr == nil {
+        t.Fatalf("Call of %s failed: %s", method, err)
+    }
+    return &replayReply{call.RemoteErr, call.Reply}
+}
+
+func TestRecordAndReplaySession(t *testing.T) {
+    filename := filepath.Join(tempDir(t), "session.msgpack")
+
+    recorder, err := newSessionRecorder(filename, "gzip")
+    if err != nil {
+        t.Fatal(err)
+    }
+    clientConn, serverConn := net.Pipe()
+    go serveEcho(serverConn)
+    client := rpcclient.NewClient(clientConn, nil, recorder)
+
+    echo := []interface{}{int64(1), "a"}
+    recorded := []*replayReply{
+        callReply(t, client, "echo", echo),
+        callReply(t, client, "fail", []interface{}{}),
+    }
+    client.Close()
+    if err = recorder.Close(); err != nil {
+        t.Fatal(err)
+    }
+
+    calls, err := readSession(filename)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(calls) != 2 || calls[0].method != "echo" || calls[1].method != "fail" {
+        t.Fatalf("Session has unexpected calls %#v", calls)
+    }
+    for i, call := range calls {
+        if !call.replied || !reflect.DeepEqual(&replayReply{call.remoteErr, call.reply}, recorded[i]) {
+            t.Fatalf("Call %s has reply %#v %#v, expected %#v", call.method, call.remoteErr, call.reply, recorded[i])
+        }
+    }
+
+    clientConn, serverConn = net.Pipe()
+    go serveSessionConn(serverConn, calls)
+    client = rpcclient.NewClient(clientConn, nil, nil)
+    defer client.Close()
+
+    for _, test := range []struct {
+        method string
+        params interface{}
+        reply  *replayReply
+    }{
+        {"echo", echo, recorded[0]},
+        // matched by method only
+        {"echo", []interface{}{int64(2)}, recorded[0]},
+        {"fail", []interface{}{}, recorded[1]},
+        {"missing", []interface{}{}, &replayReply{"No recorded reply of method missing", nil}},
+    } {
+        if reply := callReply(t, client, test.method, test.params); !reflect.DeepEqual(reply, test.reply) {
+            t.Fatalf("Replayed %s returned %#v, expected %#v", test.method, reply, test.reply)
+        }
+    }
+}
+
+func TestFindRecordedCallReplaysRepeatedCalls(t *testing.T) {
+    params := []interface{}{"a"}
+    calls := []*recordedCall{
+        {method: "next", params: params, replied: true, reply: int64(1)},
+        {method: "next", params: []interface{}{"b"}, replied: true, reply: int64(2)},
+        {method: "next", params: params, replied: true, reply: int64(3)},
+    }
+
+    cursor := newReplayCursor()
+    for _, expected := range []interface{}{int64(1), int64(3), int64(1)} {
+        if call := findRecordedCall(calls, "next", []interface{}{"a"}, cursor); call == nil || call.reply != expected {
+            t.Fatalf("Found call %#v, expected reply %v", call, expected)
+        }
+    }
+    if call := findRecordedCall(calls, "next", []interface{}{"b"}, cursor); call == nil || call.reply != int64(2) {
+        t.Fatalf("Found call %#v, expected reply 2", call)
+    }
+}
@@ -16,8 +16,14 @@ package main
 
 import (
     "bytes"
+    "context"
+    "errors"
     "fmt"
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "io"
     "net"
+    "os"
     "strconv"
     "strings"
     "time"
@@ -25,63 +31,159 @@ import (
     "unicode/utf8"
 )
 
-type RPCClient interface {
-    Call(serviceMethod string, args interface{}, reply interface{}) error
-}
-
-type RPCResult struct {
-    reply interface{}
-    err   error
-}
-
-func CallRPC(host, port, method, params string, options Options) (err error) {
+// CallRPC calls method and writes its reply to STDOUT as JSON, or as exact
+// msgpack bytes sent by server if options.rawReply is set. The call is
+// cancelled when ctx is done or options.timeout elapses after connecting to
+// server.
+func CallRPC(ctx context.Context, host, port, method, params string, options Options) (err error) {
     var (
-        args interface{}
-        conn net.Conn
+        args     interface{}
+        conn     net.Conn
+        reply    interface{}
+        handler  rpcclient.Handler
+        printer  *printingRPCHandler
+        recorder rpcclient.FrameRecorder
     )
 
-    params = adjustRPCParams(params)
-    if args, err = decodeRPCParams(params, options.convertToInt64); err != nil {
+    if args, err = getCallArgs(params, options); err != nil {
         return err
     }
 
-    if conn, err = net.Dial("tcp", host+":"+port); err != nil {
+    if options.record != "" {
+        var session *sessionRecorder
+        if session, err = newSessionRecorder(options.record, options.compression); err != nil {
+            return err
+        }
+        defer session.Close()
+        recorder = session
+    }
+
+    if options.notifications {
+        if printer, err = newPrintingRPCHandler(options); err != nil {
+            return err
+        }
+        handler = printer
+    }
+
+    if conn, err = dialRPC(ctx, host, port, options); err != nil {
         return err
     }
-    defer conn.Close()
+    client := rpcclient.NewClient(conn, handler, recorder)
+    defer client.Close()
 
-    result := make(chan RPCResult)
-    defer close(result)
+    ctx, cancel := withTimeout(ctx, options.timeout)
+    defer cancel()
 
-    go callRPC(result, conn, method, args)
+    stop := closeIfCancelled(ctx, client)
+    call := client.Go(method, args, nil)
+    stop()
+    if reply, err = waitRPCReply(ctx, call, options); err != nil {
+        return err
+    }
 
-    select {
-    case res := <-result:
-        if res.err != nil {
-            return res.err
+    if options.rawReply {
+        if _, err = os.Stdout.Write(call.RawReply); err != nil {
+            return err
         }
+    } else if data, err := encodeRPCReply(reply, options.indent); err == nil {
+        fmt.Println(data)
+    } else {
+        return err
+    }
 
-        if data, err := encodeRPCReply(res.reply, options.indent); err == nil {
-            fmt.Println(data)
-        } else {
-            return err
+    if printer != nil && printer.untilMethod != "" {
+        select {
+        case <-printer.until:
+        case <-client.Done():
+            return client.Err()
+        case <-ctx.Done():
+            return contextError(ctx)
         }
-    case <-time.After(time.Duration(options.timeout) * time.Second):
-        return fmt.Errorf("RPC call timed out")
     }
 
     return nil
 }
 
-func callRPC(result chan<- RPCResult, conn net.Conn, method string, args interface{}) {
-    client := NewMsgpackRPCClient(conn)
+// withTimeout is context.WithTimeout where zero timeout means no timeout.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+    if timeout > 0 {
+        return context.WithTimeout(ctx, timeout)
+    }
+    return context.WithCancel(ctx)
+}
+
+// closeWhenDone closes closer when ctx is done, e.g. to stop listener.
+func closeWhenDone(ctx context.Context, closer io.Closer) {
+    <-ctx.Done()
+    closer.Close()
+}
+
+// closeIfCancelled closes closer if ctx is done before the returned function
+// is called, e.g. to abort request blocked in writing to server.
+func closeIfCancelled(ctx context.Context, closer io.Closer) (stop func()) {
+    stopped := make(chan struct{})
+    go func() {
+        select {
+        case <-ctx.Done():
+            closer.Close()
+        case <-stopped:
+        }
+    }()
+    return func() { close(stopped) }
+}
+
+// dialRPC connects to host:port, or to options.fallbacks in order if it fails.
+// If all of them fail, they are tried options.retries more times with
+// exponential backoff and jitter.
+func dialRPC(ctx context.Context, host, port string, options Options) (net.Conn, error) {
+    conn, err := rpcclient.Dial(ctx, net.JoinHostPort(host, port), rpcclient.DialOptions{
+        Retries:        options.retries,
+        Backoff:        options.backoff,
+        ConnectTimeout: options.connectTimeout,
+        ReadTimeout:    options.readTimeout,
+        WriteTimeout:   options.writeTimeout,
+        Fallbacks:      options.fallbacks,
+    })
+    if err != nil {
+        if ctx.Err() != nil {
+            return nil, contextError(ctx)
+        }
+        return nil, connectionError(err)
+    }
+    return conn, nil
+}
+
+// waitRPCReply waits until the call is done or ctx is done. Error object
+// returned by server is written by writeRemoteError.
+func waitRPCReply(ctx context.Context, call *rpcclient.Call, options Options) (interface{}, error) {
+    reply, err := call.Wait(ctx)
+    if err != nil {
+        var remoteErr *rpcclient.RemoteError
+        if errors.As(err, &remoteErr) {
+            return nil, writeRemoteError(remoteErr.Value, options)
+        }
+        if ctx.Err() != nil {
+            return nil, contextError(ctx)
+        }
+    }
+    return reply, err
+}
+
+// writeRemoteError writes error object returned by server as JSON to STDERR,
+// or to STDOUT if requested, and returns it as RemoteError.
+func writeRemoteError(value interface{}, options Options) error {
+    data, err := encodeRPCReply(value, options.indent)
+    if err != nil {
+        return err
+    }
 
-    var reply interface{}
-    if err := client.Call(method, args, &reply); err != nil {
-        result <- RPCResult{reply: nil, err: fmt.Errorf("RPC error: %s", err)}
+    out := os.Stderr
+    if options.errorToStdout {
+        out = os.Stdout
     }
+    fmt.Fprintln(out, data)
 
-    result <- RPCResult{reply: reply, err: nil}
+    return &rpcclient.RemoteError{Value: value}
 }
 
 func adjustRPCParams(params string) string {
@@ -97,23 +199,32 @@ func adjustRPCParams(params string) string {
     return params
 }
 
-func decodeRPCParams(params string, convertToInt64 bool) (interface{}, error) {
-    buffer := bytes.NewBufferString(params)
-    decoder := NewJSONDecoder(buffer, convertToInt64)
-    var args interface{}
-    if err := decoder.Decode(&args); err == nil {
-        return args, nil
-    } else {
-        return nil, err
+// wrapJSONParams returns JSON params as an array. Params that are not an array
+// are passed as a single parameter.
+func wrapJSONParams(params []byte) string {
+    str := string(bytes.TrimSpace(params))
+    if str == "" || str == "null" {
+        str = "[]"
+    } else if str[0] != '[' {
+        str = "[" + str + "]"
     }
+    return str
 }
 
-func encodeRPCReply(object interface{}, indent bool) (string, error) {
-    var buffer bytes.Buffer
-    encoder := NewJSONEncoder(&buffer, indent)
-    if err := encoder.Encode(object); err == nil {
-        return buffer.String(), nil
-    } else {
-        return "", err
+// parseRPCParams decodes params given on command line to arguments of call.
+func parseRPCParams(params string, convertToInt64 bool) (interface{}, error) {
+    args, err := decodeRPCParams(adjustRPCParams(params), convertToInt64)
+    if err != nil {
+        return nil, decodeError(err)
     }
+    return args, nil
+}
+
+func decodeRPCParams(params string, convertToInt64 bool) (interface{}, error) {
+    return convert.DecodeJSON([]byte(params), convertToInt64)
+}
+
+func encodeRPCReply(object interface{}, indent bool) (string, error) {
+    data, err := convert.EncodeJSON(object, indent)
+    return string(data), err
 }
@@ -0,0 +1,60 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "net"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestCallRPCTimesOutBlockedWrite(t *testing.T) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer listener.Close()
+    host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+    // server accepts connection but never reads from it
+    go func() {
+        conn, err := listener.Accept()
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        time.Sleep(5 * time.Second)
+    }()
+
+    // larger than buffers of both sides of the connection
+    arg := "s:" + strings.Repeat("x", 32*1024*1024)
+    options := Options{timeout: 200 * time.Millisecond, args: []string{arg}}
+
+    done := make(chan error, 1)
+    go func() {
+        done <- CallRPC(context.Background(), host, port, "echo", "", options)
+    }()
+
+    select {
+    case err = <-done:
+        if exitCode(err) != exitTimeout {
+            t.Fatalf("Call returned %v, expected timeout", err)
+        }
+    case <-time.After(3 * time.Second):
+        t.Fatal("Call blocked in writing wasn't timed out")
+    }
+}
@@ -0,0 +1,367 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rpcclient is a msgpack-rpc client. Several calls can be in flight
+// at once over single connection, and requests and notifications sent by
+// server are passed to a handler.
+package rpcclient
+
+import (
+    "bufio"
+    "context"
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/ugorji/go/codec"
+    "io"
+    "net"
+    "sync"
+    "sync/atomic"
+)
+
+// Message types of msgpack-rpc frames.
+const (
+    Request      = 0
+    Response     = 1
+    Notification = 2
+)
+
+const errRequestsNotSupported = "Client doesn't accept requests"
+
+// Client calls RPC methods. Go doesn't wait for replies of previous calls,
+// each call gets its own msgid and is finished through its Done channel.
+type Client interface {
+    Call(serviceMethod string, args interface{}, reply interface{}) error
+    Go(serviceMethod string, args interface{}, done chan *Call) *Call
+    Close() error
+    // Done is closed when the connection is closed, Err returns the reason.
+    Done() <-chan struct{}
+    Err() error
+}
+
+// FrameRecorder is called with every frame sent or received by Client.
+type FrameRecorder interface {
+    RecordFrame(outgoing bool, frame []interface{})
+}
+
+// Handler handles requests and notifications sent by RPC server. Methods are
+// called synchronously by the loop reading from connection, so a slow handler
+// delays replies to pending calls and other frames until it returns.
+type Handler interface {
+    HandleRequest(msgid uint32, method string, params interface{}) (result, err interface{})
+    HandleNotification(method string, params interface{})
+}
+
+// Call is a call issued by Client. When the call is done, Err holds a
+// transport error, or RemoteErr holds the error object sent by server. Reply
+// is available decoded and as msgpack bytes sent by server.
+type Call struct {
+    Msgid     uint32
+    Method    string
+    Args      interface{}
+    Reply     interface{}
+    RawReply  []byte
+    RemoteErr interface{}
+    Err       error
+    Done      chan *Call
+}
+
+func (c *Call) finish() {
+    select {
+    case c.Done <- c:
+    default:
+        // done channel must have enough buffer space, don't block the client
+    }
+}
+
+// Wait waits until the call is done and returns its reply. Error object sent
+// by server is returned as RemoteError. If ctx is done first, its error is
+// returned.
+func (c *Call) Wait(ctx context.Context) (interface{}, error) {
+    select {
+    case <-c.Done:
+        if c.Err != nil {
+            return nil, c.Err
+        }
+        if c.RemoteErr != nil {
+            return nil, &RemoteError{c.RemoteErr}
+        }
+        return c.Reply, nil
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+// client speaks msgpack-rpc directly on the connection, so that several
+// requests can be in flight at once and msgids are known.
+type client struct {
+    conn     net.Conn
+    encoder  *codec.Encoder
+    decoder  *codec.Decoder
+    tracker  *trackingConn
+    mutex    sync.Mutex
+    msgid    uint32
+    pending  map[uint32]*Call
+    handler  Handler
+    recorder FrameRecorder
+    done     chan struct{}
+    err      error
+    // closed is set by Close before connection is closed
+    closed int32
+}
+
+// NewClient returns client that passes requests and notifications sent by
+// server to handler. If handler is nil, notifications are dropped and
+// requests are answered with an error. If recorder isn't nil, it's called with
+// every frame sent or received.
+func NewClient(c net.Conn, handler Handler, recorder FrameRecorder) Client {
+    h := convert.MsgpackHandle()
+    tracker := &trackingConn{Conn: c}
+    client := &client{
+        conn:     c,
+        handler:  handler,
+        recorder: recorder,
+        done:     make(chan struct{}),
+        encoder:  codec.NewEncoder(tracker, h),
+        decoder:  codec.NewDecoder(bufio.NewReader(tracker), h),
+        tracker:  tracker,
+        pending:  make(map[uint32]*Call),
+    }
+    go client.readLoop()
+    return client
+}
+
+func (c *client) Call(serviceMethod string, args interface{}, reply interface{}) error {
+    call := c.Go(serviceMethod, args, nil)
+    value, err := call.Wait(context.Background())
+    if err != nil {
+        return err
+    }
+
+    switch reply := reply.(type) {
+    case nil:
+    case *interface{}:
+        *reply = value
+    default:
+        // other types are decoded from reply as it was sent
+        return convert.DecodeMsgpack(call.RawReply, reply)
+    }
+
+    return nil
+}
+
+func (c *client) Go(method string, args interface{}, done chan *Call) *Call {
+    if done == nil {
+        done = make(chan *Call, 1)
+    }
+    call := &Call{Method: method, Args: args, Done: done}
+
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    if c.err != nil {
+        call.Err = c.err
+        call.finish()
+        return call
+    }
+
+    call.Msgid = c.msgid
+    c.msgid++
+    c.pending[call.Msgid] = call
+
+    if err := c.send([]interface{}{Request, call.Msgid, method, args}); err != nil {
+        delete(c.pending, call.Msgid)
+        if atomic.LoadInt32(&c.closed) != 0 {
+            err = ErrClosed
+        } else if c.tracker.writeErr != nil {
+            err = &ConnectionError{c.tracker.writeErr}
+        }
+        call.Err = err
+        call.finish()
+    }
+
+    return call
+}
+
+// send encodes frame, mutex must be held by caller. Frame is recorded before
+// it's written, so that it can't be preceded by the reply read meanwhile.
+func (c *client) send(frame []interface{}) error {
+    if c.recorder != nil {
+        c.recorder.RecordFrame(true, frame)
+    }
+    return c.encoder.Encode(frame)
+}
+
+// Close closes connection first, so that request blocked in writing by Go is
+// aborted, pending calls fail with ErrClosed.
+func (c *client) Close() error {
+    atomic.StoreInt32(&c.closed, 1)
+    err := c.conn.Close()
+
+    c.mutex.Lock()
+    if c.err == nil {
+        c.err = ErrClosed
+    }
+    c.mutex.Unlock()
+    return err
+}
+
+func (c *client) Done() <-chan struct{} {
+    return c.done
+}
+
+func (c *client) Err() error {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    return c.err
+}
+
+func (c *client) readLoop() {
+    var err error
+
+    for {
+        var raw []codec.Raw
+        if err = c.decoder.Decode(&raw); err != nil {
+            break
+        }
+        // elements are kept undecoded as well, so that exact reply is known
+        frame := make([]interface{}, len(raw))
+        for idx := range raw {
+            if err = convert.DecodeMsgpack(raw[idx], &frame[idx]); err != nil {
+                break
+            }
+        }
+        if err != nil {
+            break
+        }
+        if c.recorder != nil {
+            c.recorder.RecordFrame(false, frame)
+        }
+        if len(frame) == 0 {
+            continue
+        }
+
+        kind, _ := ParseUint32(frame[0])
+        switch {
+        case kind == Response && len(frame) == 4:
+            c.handleResponse(frame, raw[3])
+        case kind == Request && len(frame) == 4:
+            c.handleRequest(frame)
+        case kind == Notification && len(frame) == 3:
+            if method, ok := frame[1].(string); ok && c.handler != nil {
+                c.handler.HandleNotification(method, frame[2])
+            }
+        }
+    }
+
+    if atomic.LoadInt32(&c.closed) != 0 {
+        err = ErrClosed
+    } else if c.tracker.readErr != nil {
+        if err = c.tracker.readErr; err == io.EOF {
+            err = io.ErrUnexpectedEOF
+        }
+        err = &ConnectionError{err}
+    } else if _, ok := err.(*convert.DecodeError); !ok {
+        err = &convert.DecodeError{Err: err}
+    }
+
+    c.mutex.Lock()
+    if c.err == nil {
+        c.err = err
+    }
+    for msgid, call := range c.pending {
+        delete(c.pending, msgid)
+        call.Err = c.err
+        call.finish()
+    }
+    c.mutex.Unlock()
+
+    close(c.done)
+}
+
+func (c *client) handleResponse(frame []interface{}, rawReply []byte) {
+    msgid, ok := ParseUint32(frame[1])
+    if !ok {
+        return
+    }
+
+    c.mutex.Lock()
+    call := c.pending[msgid]
+    delete(c.pending, msgid)
+    c.mutex.Unlock()
+
+    if call != nil {
+        call.RemoteErr = frame[2]
+        call.Reply = frame[3]
+        call.RawReply = rawReply
+        call.finish()
+    }
+}
+
+func (c *client) handleRequest(frame []interface{}) {
+    var (
+        result interface{}
+        err    interface{} = errRequestsNotSupported
+    )
+
+    msgid, ok := ParseUint32(frame[1])
+    if !ok {
+        return
+    }
+    if method, ok := frame[2].(string); ok && c.handler != nil {
+        result, err = c.handler.HandleRequest(msgid, method, frame[3])
+    }
+
+    // don't block reading while sending of a request is in progress
+    go func() {
+        c.mutex.Lock()
+        defer c.mutex.Unlock()
+        if c.err == nil {
+            c.send([]interface{}{Response, msgid, err, result})
+        }
+    }()
+}
+
+// ParseUint32 converts integer decoded from msgpack, e.g. message type or
+// msgid of frame, to uint32. It returns false if the value is not an integer
+// in range of uint32.
+func ParseUint32(v interface{}) (uint32, bool) {
+    switch n := v.(type) {
+    case uint64:
+        return uint32(n), n <= 0xffffffff
+    case int64:
+        return uint32(n), n >= 0 && n <= 0xffffffff
+    }
+    return 0, false
+}
+
+// trackingConn remembers errors returned by connection, so that they can be
+// told apart from encoding and decoding errors.
+type trackingConn struct {
+    net.Conn
+    readErr  error
+    writeErr error
+}
+
+func (c *trackingConn) Read(p []byte) (n int, err error) {
+    if n, err = c.Conn.Read(p); err != nil {
+        c.readErr = err
+    }
+    return n, err
+}
+
+func (c *trackingConn) Write(p []byte) (n int, err error) {
+    if n, err = c.Conn.Write(p); err != nil {
+        c.writeErr = err
+    }
+    return n, err
+}
@@ -0,0 +1,172 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcclient
+
+import (
+    "github.com/jakm/msgpack-cli/convert"
+    "github.com/ugorji/go/codec"
+    "net"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestClientMatchesRepliesByMsgid(t *testing.T) {
+    clientConn, serverConn := net.Pipe()
+    defer serverConn.Close()
+
+    client := NewClient(clientConn, nil, nil)
+    defer client.Close()
+
+    // reply in reverse order, the second call fails
+    go func() {
+        h := convert.MsgpackHandle()
+        decoder := codec.NewDecoder(serverConn, h)
+        encoder := codec.NewEncoder(serverConn, h)
+
+        var requests [][]interface{}
+        for len(requests) < 2 {
+            var frame []interface{}
+            if err := decoder.Decode(&frame); err != nil {
+                return
+            }
+            requests = append(requests, frame)
+        }
+
+        encoder.Encode([]interface{}{Response, requests[1][1], "failure", nil})
+        encoder.Encode([]interface{}{Response, requests[0][1], nil, requests[0][3]})
+    }()
+
+    calls := []*Call{
+        client.Go("first", []interface{}{int64(1)}, nil),
+        client.Go("second", []interface{}{int64(2)}, nil),
+    }
+
+    first := <-calls[0].Done
+    if first.Err != nil || first.RemoteErr != nil {
+        t.Fatalf("First call failed: %v %v", first.Err, first.RemoteErr)
+    }
+    if !reflect.DeepEqual(first.Reply, []interface{}{int64(1)}) {
+        t.Fatalf("First call returned unexpected reply %#v", first.Reply)
+    }
+    if !reflect.DeepEqual(first.RawReply, []byte{0x91, 0x01}) {
+        t.Fatalf("First call returned unexpected raw reply %#v", first.RawReply)
+    }
+
+    second := <-calls[1].Done
+    if second.RemoteErr != "failure" {
+        t.Fatalf("Second call returned unexpected error %#v", second.RemoteErr)
+    }
+    if first.Msgid == second.Msgid {
+        t.Fatalf("Calls share msgid %d", first.Msgid)
+    }
+}
+
+func TestClientFailsPendingCallsOnClose(t *testing.T) {
+    clientConn, serverConn := net.Pipe()
+
+    client := NewClient(clientConn, nil, nil)
+    defer client.Close()
+
+    done := make(chan *Call, 1)
+    go client.Go("method", []interface{}{}, done)
+
+    var frame []interface{}
+    if err := codec.NewDecoder(serverConn, convert.MsgpackHandle()).Decode(&frame); err != nil {
+        t.Fatal(err)
+    }
+    serverConn.Close()
+
+    if call := <-done; call.Err == nil {
+        t.Fatal("Pending call didn't fail after connection was closed")
+    }
+}
+
+type staticHandler struct {
+    notifications chan string
+}
+
+func (h *staticHandler) HandleRequest(msgid uint32, method string, params interface{}) (result, err interface{}) {
+    return method, nil
+}
+
+func (h *staticHandler) HandleNotification(method string, params interface{}) {
+    h.notifications <- method
+}
+
+func TestClientPassesServerFramesToHandler(t *testing.T) {
+    clientConn, serverConn := net.Pipe()
+    defer serverConn.Close()
+
+    handler := &staticHandler{make(chan string, 1)}
+    client := NewClient(clientConn, handler, nil)
+    defer client.Close()
+
+    h := convert.MsgpackHandle()
+    encoder := codec.NewEncoder(serverConn, h)
+    decoder := codec.NewDecoder(serverConn, h)
+
+    if err := encoder.Encode([]interface{}{Notification, "event", []interface{}{}}); err != nil {
+        t.Fatal(err)
+    }
+    if method := <-handler.notifications; method != "event" {
+        t.Fatalf("Handler received unexpected notification %s", method)
+    }
+
+    if err := encoder.Encode([]interface{}{Request, 7, "question", []interface{}{}}); err != nil {
+        t.Fatal(err)
+    }
+    var frame []interface{}
+    if err := decoder.Decode(&frame); err != nil {
+        t.Fatal(err)
+    }
+    expected := []interface{}{int64(Response), int64(7), nil, "question"}
+    if !reflect.DeepEqual(frame, expected) {
+        t.Fatalf("Client sent unexpected response %#v", frame)
+    }
+}
+
+func TestClientCloseAbortsBlockedWrite(t *testing.T) {
+    clientConn, serverConn := net.Pipe()
+    defer serverConn.Close()
+
+    // server doesn't read, so that writing of request blocks
+    client := NewClient(clientConn, nil, nil)
+    calls := make(chan *Call, 1)
+    go func() {
+        calls <- client.Go("method", []interface{}{}, nil)
+    }()
+    time.Sleep(20 * time.Millisecond)
+
+    closed := make(chan struct{})
+    go func() {
+        client.Close()
+        close(closed)
+    }()
+
+    select {
+    case call := <-calls:
+        if call.Err != ErrClosed {
+            t.Fatalf("Aborted call returned %#v", call.Err)
+        }
+    case <-time.After(3 * time.Second):
+        t.Fatal("Write of request wasn't aborted")
+    }
+    select {
+    case <-closed:
+    case <-time.After(3 * time.Second):
+        t.Fatal("Close is blocked")
+    }
+}
@@ -0,0 +1,123 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcclient
+
+import (
+    "context"
+    "math/rand"
+    "net"
+    "time"
+)
+
+// maxBackoff limits delay between retries of Dial.
+const maxBackoff = 30 * time.Second
+
+// DialOptions of Dial. Zero values mean no retries, no fallbacks and no
+// timeouts.
+type DialOptions struct {
+    // Retries is number of attempts after all endpoints failed to connect.
+    Retries int
+    // Backoff is delay before the first retry, it's doubled before each next
+    // one up to 30 seconds and randomized by jitter.
+    Backoff time.Duration
+    // ConnectTimeout limits each attempt to connect.
+    ConnectTimeout time.Duration
+    // ReadTimeout and WriteTimeout limit each read and write on connection.
+    ReadTimeout  time.Duration
+    WriteTimeout time.Duration
+    // Fallbacks are endpoints <host>:<port> tried in order if address fails.
+    Fallbacks []string
+}
+
+// Dial connects to address (<host>:<port>), or to options.Fallbacks in order
+// if it fails. If all of them fail, they are tried options.Retries more times
+// with exponential backoff and jitter. It returns ConnectionError with the
+// last failure, or error of ctx if it's done.
+func Dial(ctx context.Context, address string, options DialOptions) (conn net.Conn, err error) {
+    endpoints := append([]string{address}, options.Fallbacks...)
+    dialer := net.Dialer{Timeout: options.ConnectTimeout}
+    random := rand.New(rand.NewSource(time.Now().UnixNano()))
+    delay := options.Backoff
+    if delay > maxBackoff {
+        delay = maxBackoff
+    }
+
+    for attempt := 0; ; attempt++ {
+        for _, endpoint := range endpoints {
+            if conn, err = dialer.DialContext(ctx, "tcp", endpoint); err == nil {
+                if options.ReadTimeout > 0 || options.WriteTimeout > 0 {
+                    conn = &deadlineConn{conn, options.ReadTimeout, options.WriteTimeout}
+                }
+                return conn, nil
+            }
+            if ctx.Err() != nil {
+                return nil, ctx.Err()
+            }
+        }
+
+        if attempt >= options.Retries {
+            break
+        }
+
+        if delay > 0 {
+            select {
+            case <-time.After(delay/2 + time.Duration(random.Int63n(int64(delay/2)+1))):
+            case <-ctx.Done():
+                return nil, ctx.Err()
+            }
+            if delay < maxBackoff/2 {
+                delay *= 2
+            } else {
+                delay = maxBackoff
+            }
+        }
+    }
+
+    return nil, &ConnectionError{err}
+}
+
+// Invoke connects to address, calls method and returns its reply. Error
+// object returned by server is returned as RemoteError.
+func Invoke(ctx context.Context, address, method string, args interface{}, options DialOptions) (interface{}, error) {
+    conn, err := Dial(ctx, address, options)
+    if err != nil {
+        return nil, err
+    }
+    client := NewClient(conn, nil, nil)
+    defer client.Close()
+
+    return client.Go(method, args, nil).Wait(ctx)
+}
+
+// deadlineConn sets deadline of every read and write on the connection.
+type deadlineConn struct {
+    net.Conn
+    readTimeout  time.Duration
+    writeTimeout time.Duration
+}
+
+func (c *deadlineConn) Read(p []byte) (int, error) {
+    if c.readTimeout > 0 {
+        c.Conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+    }
+    return c.Conn.Read(p)
+}
+
+func (c *deadlineConn) Write(p []byte) (int, error) {
+    if c.writeTimeout > 0 {
+        c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+    }
+    return c.Conn.Write(p)
+}
@@ -0,0 +1,120 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcclient
+
+import (
+    "context"
+    "net"
+    "testing"
+    "time"
+)
+
+// unusedAddress returns address where nothing listens.
+func unusedAddress(t *testing.T) string {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    address := listener.Addr().String()
+    listener.Close()
+    return address
+}
+
+func TestDialRetriesUntilServerListens(t *testing.T) {
+    address := unusedAddress(t)
+
+    accepted := make(chan net.Listener, 1)
+    go func() {
+        time.Sleep(50 * time.Millisecond)
+        listener, err := net.Listen("tcp", address)
+        if err != nil {
+            accepted <- nil
+            return
+        }
+        accepted <- listener
+        if conn, err := listener.Accept(); err == nil {
+            conn.Close()
+        }
+    }()
+
+    conn, err := Dial(context.Background(), address, DialOptions{Retries: 20, Backoff: 10 * time.Millisecond})
+    if listener := <-accepted; listener != nil {
+        defer listener.Close()
+    } else {
+        t.Skip("Address was taken meanwhile")
+    }
+    if err != nil {
+        t.Fatalf("Dial failed: %s", err)
+    }
+    conn.Close()
+}
+
+func TestDialFallsBackAndFails(t *testing.T) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer listener.Close()
+    go func() {
+        if conn, err := listener.Accept(); err == nil {
+            conn.Close()
+        }
+    }()
+
+    options := DialOptions{Fallbacks: []string{listener.Addr().String()}}
+    conn, err := Dial(context.Background(), unusedAddress(t), options)
+    if err != nil {
+        t.Fatalf("Dial didn't fall back: %s", err)
+    }
+    conn.Close()
+
+    _, err = Dial(context.Background(), unusedAddress(t), DialOptions{Retries: 2, Backoff: time.Millisecond})
+    if _, ok := err.(*ConnectionError); !ok {
+        t.Fatalf("Dial returned unexpected error %#v", err)
+    }
+}
+
+func TestDeadlineConnTimesOutIdleRead(t *testing.T) {
+    client, server := net.Pipe()
+    defer server.Close()
+    conn := &deadlineConn{client, 20 * time.Millisecond, 20 * time.Millisecond}
+    defer conn.Close()
+
+    go func() {
+        server.Write([]byte("x"))
+    }()
+    buf := make([]byte, 1)
+    if _, err := conn.Read(buf); err != nil {
+        t.Fatalf("Read failed: %s", err)
+    }
+
+    // deadline is moved by every read, nothing more is written
+    time.Sleep(30 * time.Millisecond)
+    go func() {
+        time.Sleep(5 * time.Millisecond)
+        server.Write([]byte("y"))
+    }()
+    if _, err := conn.Read(buf); err != nil || buf[0] != 'y' {
+        t.Fatalf("Read after previous deadline failed: %v", err)
+    }
+
+    _, err := conn.Read(buf)
+    if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+        t.Fatalf("Idle read returned %#v, expected timeout", err)
+    }
+    if _, err = conn.Write([]byte("z")); err == nil {
+        t.Fatal("Write without reader didn't time out")
+    }
+}
@@ -0,0 +1,53 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcclient
+
+import (
+    "errors"
+    "fmt"
+    "net"
+)
+
+// ErrClosed is returned by calls of closed client.
+var ErrClosed = errors.New("RPC client is closed")
+
+// RemoteError holds an error object returned by RPC server.
+type RemoteError struct {
+    Value interface{}
+}
+
+func (e *RemoteError) Error() string {
+    return fmt.Sprintf("RPC error: %v", e.Value)
+}
+
+// ConnectionError is returned when server can't be connected, or when
+// connection fails during a call.
+type ConnectionError struct {
+    Err error
+}
+
+func (e *ConnectionError) Error() string {
+    return e.Err.Error()
+}
+
+func (e *ConnectionError) Unwrap() error {
+    return e.Err
+}
+
+// Timeout reports whether connection failed because of its deadline.
+func (e *ConnectionError) Timeout() bool {
+    var netErr net.Error
+    return errors.As(e.Err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,302 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "net"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// replyChange is an element of structural diff of two replies.
+type replyChange struct {
+    Op   string      `json:"op"`
+    Path string      `json:"path"`
+    Old  interface{} `json:"old"`
+    New  interface{} `json:"new"`
+}
+
+// WatchRPC calls method every options.watch over single connection and writes
+// replies to STDOUT. If options.changesOnly is set, reply is written only if
+// it differs from the previous one, as a structural diff if options.diff is
+// set. Watching stops when ctx is done, options.count calls are made or value
+// at options.untilPath equals options.untilValue. Error objects returned by
+// server are written to STDERR and watching goes on, error of the last call
+// is returned.
+func WatchRPC(ctx context.Context, host, port, method, params string, options Options) (err error) {
+    var (
+        args     interface{}
+        conn     net.Conn
+        recorder rpcclient.FrameRecorder
+        previous interface{}
+        replied  bool
+    )
+
+    if args, err = getCallArgs(params, options); err != nil {
+        return err
+    }
+
+    if options.record != "" {
+        var session *sessionRecorder
+        if session, err = newSessionRecorder(options.record, options.compression); err != nil {
+            return err
+        }
+        defer session.Close()
+        recorder = session
+    }
+
+    if conn, err = dialRPC(ctx, host, port, options); err != nil {
+        return err
+    }
+    client := rpcclient.NewClient(conn, nil, recorder)
+    defer client.Close()
+
+    ticker := time.NewTicker(options.watch)
+    defer ticker.Stop()
+
+    for n := 1; ; n++ {
+        callCtx, cancel := withTimeout(ctx, options.timeout)
+        stop := closeIfCancelled(callCtx, client)
+        call := client.Go(method, args, nil)
+        stop()
+        reply, err := waitRPCReply(callCtx, call, options)
+        cancel()
+
+        var remoteErr *rpcclient.RemoteError
+        switch {
+        case ctx.Err() != nil:
+            return contextError(ctx)
+        case errors.As(err, &remoteErr):
+            // already written, server may recover until the last call
+        case err != nil:
+            return err
+        default:
+            if err = writeWatchedReply(call, previous, replied, options); err != nil {
+                return err
+            }
+            previous, replied = reply, true
+
+            if options.untilPath != nil {
+                if value, ok := lookupJSONPath(reply, options.untilPath); ok && jsonEqual(value, options.untilValue) {
+                    return nil
+                }
+            }
+        }
+
+        if options.count > 0 && n >= options.count {
+            return err
+        }
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return contextError(ctx)
+        case <-client.Done():
+            return client.Err()
+        }
+    }
+}
+
+func writeWatchedReply(call *rpcclient.Call, previous interface{}, replied bool, options Options) error {
+    if replied && options.changesOnly && jsonEqual(previous, call.Reply) {
+        return nil
+    }
+
+    var object interface{} = call.Reply
+    switch {
+    case replied && options.diff:
+        changes := diffReplies(nil, previous, call.Reply, nil)
+        if len(changes) == 0 {
+            // replies may differ only in JSON encoding, e.g. order of keys
+            return nil
+        }
+        object = changes
+    case options.rawReply:
+        _, err := os.Stdout.Write(call.RawReply)
+        return err
+    }
+
+    data, err := encodeRPCReply(object, options.indent)
+    if err != nil {
+        return err
+    }
+    fmt.Print(data)
+    return nil
+}
+
+// diffReplies appends to changes differences between old and new values at
+// path. Maps and arrays are compared by elements, other values as a whole.
+func diffReplies(path []interface{}, old, new interface{}, changes []replyChange) []replyChange {
+    switch oldValue := old.(type) {
+    case map[string]interface{}:
+        if newValue, ok := new.(map[string]interface{}); ok {
+            for _, key := range sortedUnionKeys(oldValue, newValue) {
+                elemPath := append(path[:len(path):len(path)], key)
+                o, inOld := oldValue[key]
+                n, inNew := newValue[key]
+                switch {
+                case !inNew:
+                    changes = append(changes, replyChange{"remove", formatJSONPath(elemPath), o, nil})
+                case !inOld:
+                    changes = append(changes, replyChange{"add", formatJSONPath(elemPath), nil, n})
+                default:
+                    changes = diffReplies(elemPath, o, n, changes)
+                }
+            }
+            return changes
+        }
+    case []interface{}:
+        if newValue, ok := new.([]interface{}); ok {
+            for idx := 0; idx < len(oldValue) || idx < len(newValue); idx++ {
+                elemPath := append(path[:len(path):len(path)], idx)
+                switch {
+                case idx >= len(newValue):
+                    changes = append(changes, replyChange{"remove", formatJSONPath(elemPath), oldValue[idx], nil})
+                case idx >= len(oldValue):
+                    changes = append(changes, replyChange{"add", formatJSONPath(elemPath), nil, newValue[idx]})
+                default:
+                    changes = diffReplies(elemPath, oldValue[idx], newValue[idx], changes)
+                }
+            }
+            return changes
+        }
+    }
+
+    if !jsonEqual(old, new) {
+        changes = append(changes, replyChange{"replace", formatJSONPath(path), old, new})
+    }
+    return changes
+}
+
+func sortedUnionKeys(a, b map[string]interface{}) []string {
+    keys := make([]string, 0, len(a)+len(b))
+    for key := range a {
+        keys = append(keys, key)
+    }
+    for key := range b {
+        if _, ok := a[key]; !ok {
+            keys = append(keys, key)
+        }
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// jsonEqual compares values by their JSON representation, so that numbers
+// decoded to different types are equal.
+func jsonEqual(a, b interface{}) bool {
+    aData, err := encodeRPCReply(a, false)
+    if err != nil {
+        return false
+    }
+    bData, err := encodeRPCReply(b, false)
+    return err == nil && aData == bData
+}
+
+// parseJSONPath parses path like $.items[0].name or $["key"] to keys of maps
+// (strings) and indexes of arrays (ints). Leading $ is optional.
+func parseJSONPath(path string) ([]interface{}, error) {
+    elems := []interface{}{}
+
+    rest := strings.TrimPrefix(path, "$")
+    for rest != "" {
+        switch rest[0] {
+        case '.':
+            end := strings.IndexAny(rest[1:], ".[")
+            if end < 0 {
+                end = len(rest) - 1
+            }
+            if end == 0 {
+                return nil, fmt.Errorf("Invalid JSON path %s", path)
+            }
+            elems = append(elems, rest[1:end+1])
+            rest = rest[end+1:]
+        case '[':
+            end := strings.IndexByte(rest, ']')
+            if end < 0 {
+                return nil, fmt.Errorf("Invalid JSON path %s", path)
+            }
+            inner := rest[1:end]
+            if strings.HasPrefix(inner, "\"") {
+                key, err := strconv.Unquote(inner)
+                if err != nil {
+                    return nil, fmt.Errorf("Invalid JSON path %s", path)
+                }
+                elems = append(elems, key)
+            } else {
+                idx, err := strconv.Atoi(inner)
+                if err != nil || idx < 0 {
+                    return nil, fmt.Errorf("Invalid JSON path %s", path)
+                }
+                elems = append(elems, idx)
+            }
+            rest = rest[end+1:]
+        default:
+            if len(elems) > 0 || strings.HasPrefix(path, "$") {
+                return nil, fmt.Errorf("Invalid JSON path %s", path)
+            }
+            rest = "." + rest
+        }
+    }
+
+    return elems, nil
+}
+
+func formatJSONPath(path []interface{}) string {
+    var builder strings.Builder
+    builder.WriteString("$")
+    for _, elem := range path {
+        switch elem := elem.(type) {
+        case int:
+            fmt.Fprintf(&builder, "[%d]", elem)
+        case string:
+            if elem != "" && !strings.ContainsAny(elem, ".[]\" ") {
+                builder.WriteString("." + elem)
+            } else {
+                builder.WriteString("[" + strconv.Quote(elem) + "]")
+            }
+        }
+    }
+    return builder.String()
+}
+
+func lookupJSONPath(value interface{}, path []interface{}) (interface{}, bool) {
+    for _, elem := range path {
+        switch elem := elem.(type) {
+        case int:
+            array, ok := value.([]interface{})
+            if !ok || elem >= len(array) {
+                return nil, false
+            }
+            value = array[elem]
+        case string:
+            object, ok := value.(map[string]interface{})
+            if !ok {
+                return nil, false
+            }
+            if value, ok = object[elem]; !ok {
+                return nil, false
+            }
+        }
+    }
+    return value, true
+}
@@ -0,0 +1,86 @@
+// Copyright 2014-2015 Jakub Matys
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+    "github.com/jakm/msgpack-cli/rpcclient"
+    "reflect"
+    "testing"
+)
+
+func TestJSONPath(t *testing.T) {
+    reply := map[string]interface{}{
+        "items": []interface{}{map[string]interface{}{"a.b": "x"}},
+    }
+
+    for _, path := range []string{"$.items[0][\"a.b\"]", "items[0][\"a.b\"]"} {
+        elems, err := parseJSONPath(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if value, ok := lookupJSONPath(reply, elems); !ok || value != "x" {
+            t.Fatalf("Value at path %s is %#v", path, value)
+        }
+        if formatted := formatJSONPath(elems); formatted != "$.items[0][\"a.b\"]" {
+            t.Fatalf("Path %s was formatted as %s", path, formatted)
+        }
+    }
+
+    for _, path := range []string{"$..a", "$[x]", "$a", "$.a[0"} {
+        if _, err := parseJSONPath(path); err == nil {
+            t.Fatalf("Invalid path %s was accepted", path)
+        }
+    }
+}
+
+func TestDiffReplies(t *testing.T) {
+    old := map[string]interface{}{"n": int64(1), "gone": true, "list": []interface{}{"a", "b"}}
+    new := map[string]interface{}{"n": uint64(2), "added": nil, "list": []interface{}{"a"}}
+
+    expected := []replyChange{
+        {"add", "$.added", nil, nil},
+        {"remove", "$.gone", true, nil},
+        {"remove", "$.list[1]", "b", nil},
+        {"replace", "$.n", int64(1), uint64(2)},
+    }
+    if changes := diffReplies(nil, old, new, nil); !reflect.DeepEqual(changes, expected) {
+        t.Fatalf("Unexpected changes %#v", changes)
+    }
+
+    if changes := diffReplies(nil, int64(1), uint64(1), nil); len(changes) != 0 {
+        t.Fatalf("Equal numbers differ: %#v", changes)
+    }
+}
+
+func TestWriteWatchedReplySkipsEmptyDiff(t *testing.T) {
+    // without changesOnly, so that equal replies are diffed
+    options := Options{diff: true}
+    previous := map[string]interface{}{"a": int64(1), "b": int64(2), "c": int64(3)}
+
+    output := captureStdout(t, func() {
+        for _, reply := range []interface{}{
+            map[string]interface{}{"c": uint64(3), "b": uint64(2), "a": uint64(1)},
+            map[string]interface{}{"a": int64(1), "b": int64(2)},
+        } {
+            if err := writeWatchedReply(&rpcclient.Call{Reply: reply}, previous, true, options); err != nil {
+                t.Error(err)
+            }
+        }
+    })
+
+    if expected := `[{"op":"remove","path":"$.c","old":3,"new":null}]` + "\n"; output != expected {
+        t.Fatalf("Diffs were written as %q, expected %q", output, expected)
+    }
+}